@@ -3,15 +3,18 @@ package services
 import (
 	"bufio"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
-
+// how much of the start of a file is checksummed to notice it being rewritten
+const headBytes = 1024
 
 func NewLogFileHandler(filePath string, logger *log.Logger, centrifugoClient *CentrifugoClient, natsClient *NatsClient, channelID, subject string) (*LogFileHandler, error) {
 	handler := &LogFileHandler{
@@ -35,86 +38,213 @@ func (h *LogFileHandler) InitializePosition() error {
 	h.Mu.Lock()
 	defer h.Mu.Unlock()
 
+	_, err := h.openFile(true)
+	return err
+}
+
+// CollectNewLogs publishes the lines written since the last call. The file is
+// kept open between calls, so once it is rotated (renamed or removed, and
+// maybe replaced by a new file at the same path) the rest of the old file is
+// still read before the new one is read from its start. A file truncated in
+// place is read again from the start, even when it has grown past the old
+// position since, as its first bytes no longer match.
+func (h *LogFileHandler) CollectNewLogs(logger *log.Logger) error {
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
+
+	if h.File == nil {
+		opened, err := h.openFile(false)
+		if err != nil || !opened {
+			return err
+		}
+	}
+
+	truncated, err := h.truncated()
+	if err != nil {
+		return err
+	}
+	if truncated {
+		logger.Printf("%s was truncated, reading it from the start", h.FilePath)
+		h.LastPosition, h.HeadLen, h.HeadSum = 0, 0, 0
+	}
+
+	if err := h.readLines(logger, false); err != nil {
+		return err
+	}
+
+	// os.SameFile compares device and inode, so a new file at the path is
+	// told apart from the one still open
+	current, err := os.Stat(h.FilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error checking file: %w", err)
+	}
+	if err == nil && os.SameFile(current, h.FileInfo) {
+		return nil
+	}
+
+	// nobody writes to the old file any more, so an unfinished last line
+	// is all there is of it
+	if err := h.readLines(logger, true); err != nil {
+		return err
+	}
+	h.closeFile()
+
+	if current == nil {
+		logger.Printf("%s was removed, waiting for it to be created again", h.FilePath)
+		return nil
+	}
+	logger.Printf("%s was rotated, reading the new file", h.FilePath)
+	if opened, err := h.openFile(false); err != nil || !opened {
+		return err
+	}
+	return h.readLines(logger, false)
+}
+
+// openFile opens the file at FilePath to be read from its start, or from its
+// end when atEnd is set. It reports false when there is no file yet.
+func (h *LogFileHandler) openFile(atEnd bool) (bool, error) {
 	file, err := os.Open(h.FilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return false, nil
 		}
+		return false, fmt.Errorf("error opening file: %w", err)
 	}
-	defer file.Close()
 
-	pos, err := file.Seek(0, io.SeekEnd)
+	info, err := file.Stat()
 	if err != nil {
-		return err
+		file.Close()
+		return false, fmt.Errorf("error checking file: %w", err)
 	}
 
-	h.LastPosition = pos
+	h.File = file
+	h.FileInfo = info
+	h.LastPosition, h.HeadLen, h.HeadSum = 0, 0, 0
+	if atEnd {
+		h.LastPosition = info.Size()
+	}
+	return true, h.updateHead()
+}
+
+// truncated reports whether the open file was cut short since it was last
+// read: it is smaller than the position read to, or its first bytes changed.
+func (h *LogFileHandler) truncated() (bool, error) {
+	info, err := h.File.Stat()
+	if err != nil {
+		return false, fmt.Errorf("error checking file: %w", err)
+	}
+	if info.Size() < h.LastPosition {
+		return true, nil
+	}
+	if h.HeadLen == 0 {
+		return false, nil
+	}
+	sum, err := h.checksum(h.HeadLen)
+	if err != nil {
+		return false, err
+	}
+	return sum != h.HeadSum, nil
+}
+
+// updateHead checksums the start of the file once more of it has been read,
+// up to headBytes.
+func (h *LogFileHandler) updateHead() error {
+	n := min(h.LastPosition, headBytes)
+	if n <= h.HeadLen {
+		return nil
+	}
+	sum, err := h.checksum(n)
+	if err != nil {
+		return err
+	}
+	h.HeadLen, h.HeadSum = n, sum
 	return nil
 }
 
-func (h *LogFileHandler) CollectNewLogs(logger *log.Logger) error {
+func (h *LogFileHandler) checksum(n int64) (uint32, error) {
+	head := make([]byte, n)
+	if _, err := h.File.ReadAt(head, 0); err != nil && err != io.EOF {
+		return 0, fmt.Errorf("error reading file: %w", err)
+	}
+	return crc32.ChecksumIEEE(head), nil
+}
+
+func (h *LogFileHandler) closeFile() {
+	h.File.Close()
+	h.File = nil
+	h.FileInfo = nil
+	h.LastPosition, h.HeadLen, h.HeadSum = 0, 0, 0
+}
+
+// Close releases the open file.
+func (h *LogFileHandler) Close() {
 	h.Mu.Lock()
 	defer h.Mu.Unlock()
 
-	file, err := os.Open(h.FilePath)
-	if err != nil {
-		return fmt.Errorf("error opening file: %w", err)
+	if h.File != nil {
+		h.closeFile()
 	}
-	defer file.Close()
+}
 
-	_, err = file.Seek(h.LastPosition, io.SeekStart)
-	if err != nil {
+// readLines publishes the complete lines after LastPosition. A line still
+// being written is left for the next call, unless final is set.
+func (h *LogFileHandler) readLines(logger *log.Logger, final bool) error {
+	if _, err := h.File.Seek(h.LastPosition, io.SeekStart); err != nil {
 		return fmt.Errorf("error seeking file: %w", err)
 	}
 
-	scanner := bufio.NewScanner(file)
+	reader := bufio.NewReader(h.File)
 	hasNewContent := false
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(line) > 0 {
-			fmt.Printf("Collected: %s\n", line)
-			if h.CentrifugoClient != nil {
-				logMsg := LogMessage{
-					Timestamp: time.Now().Format(time.RFC3339),
-					FilePath:  h.FilePath,
-					Line:      line,
-				}
-				if err := h.CentrifugoClient.PublishLog(h.ChannelID, logMsg); err != nil {
-					logger.Printf("Failed to publish log: %v", err)
-				}
-
-			}
-
-			if h.NatsClient.NatsConn != nil {
-				// logMsg := LogMessage{
-				// 	Timestamp: time.Now().Format(time.RFC3339),
-				// 	FilePath:  h.FilePath,
-				// 	Line:      line,
-				// }
-				if err := h.NatsClient.PublishLogToNats(h.Subject, line); err != nil {
-					logger.Printf("Failed to publish log to NATS: %v", err)
-				}
-			}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("error reading file: %w", err)
+		}
+		if line == "" || (err == io.EOF && !final) {
+			break
+		}
+
+		h.LastPosition += int64(len(line))
+		if line = strings.TrimRight(line, "\r\n"); len(line) > 0 {
+			h.publish(logger, line)
 			hasNewContent = true
 		}
+		if err == io.EOF {
+			break
+		}
 	}
 
 	if hasNewContent {
 		fmt.Println("---------------------------------------")
 	}
+	return h.updateHead()
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading file: %w", err)
-	}
+func (h *LogFileHandler) publish(logger *log.Logger, line string) {
+	fmt.Printf("Collected: %s\n", line)
+	if h.CentrifugoClient != nil {
+		logMsg := LogMessage{
+			Timestamp: time.Now().Format(time.RFC3339),
+			FilePath:  h.FilePath,
+			Line:      line,
+		}
+		if err := h.CentrifugoClient.PublishLog(h.ChannelID, logMsg); err != nil {
+			logger.Printf("Failed to publish log: %v", err)
+		}
 
-	newPos, err := file.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return fmt.Errorf("error getting file position: %w", err)
 	}
 
-	h.LastPosition = newPos
-	return nil
+	if h.NatsClient.NatsConn != nil {
+		// logMsg := LogMessage{
+		// 	Timestamp: time.Now().Format(time.RFC3339),
+		// 	FilePath:  h.FilePath,
+		// 	Line:      line,
+		// }
+		if err := h.NatsClient.PublishLogToNats(h.Subject, line); err != nil {
+			logger.Printf("Failed to publish log to NATS: %v", err)
+		}
+	}
 }
 
 func LoadConfig(configPath string, logger *log.Logger) (Config, error) {
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestHandler(t *testing.T, path string) *LogFileHandler {
+	t.Helper()
+	handler, err := NewLogFileHandler(path, log.New(io.Discard, "", 0), nil, &NatsClient{}, "logs", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(handler.Close)
+	return handler
+}
+
+// collect runs CollectNewLogs and returns the lines it published, which it
+// prints to stdout.
+func collect(t *testing.T, h *LogFileHandler) []string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+
+	printed := make(chan []string)
+	go func() {
+		var lines []string
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if line, ok := strings.CutPrefix(scanner.Text(), "Collected: "); ok {
+				lines = append(lines, line)
+			}
+		}
+		printed <- lines
+	}()
+
+	collectErr := h.CollectNewLogs(log.New(io.Discard, "", 0))
+	os.Stdout = stdout
+	w.Close()
+	lines := <-printed
+	r.Close()
+
+	if collectErr != nil {
+		t.Fatal(collectErr)
+	}
+	return lines
+}
+
+func appendTo(t *testing.T, path, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectLines(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collected %q, want %q", got, want)
+	}
+}
+
+func TestCollectSkipsExistingLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendTo(t, path, "old\n")
+	h := newTestHandler(t, path)
+
+	expectLines(t, collect(t, h))
+	appendTo(t, path, "new\n")
+	expectLines(t, collect(t, h), "new")
+}
+
+func TestCollectAfterRotation(t *testing.T) {
+	tests := []struct {
+		name   string
+		rotate func(path string) error
+	}{
+		{"rename", func(path string) error { return os.Rename(path, path+".1") }},
+		{"remove", os.Remove},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			appendTo(t, path, "")
+			h := newTestHandler(t, path)
+
+			appendTo(t, path, "a\nb\n")
+			expectLines(t, collect(t, h), "a", "b")
+
+			// the last lines of the old file are only written before it is
+			// rotated away, and the new file already has a line once the
+			// collector notices
+			appendTo(t, path, "c\n")
+			if err := tt.rotate(path); err != nil {
+				t.Fatal(err)
+			}
+			appendTo(t, path, "d\n")
+			expectLines(t, collect(t, h), "c", "d")
+
+			appendTo(t, path, "e\n")
+			expectLines(t, collect(t, h), "e")
+		})
+	}
+}
+
+func TestCollectWhileRemoved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendTo(t, path, "")
+	h := newTestHandler(t, path)
+
+	appendTo(t, path, "a\n")
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, collect(t, h), "a")
+	expectLines(t, collect(t, h))
+
+	appendTo(t, path, "b\n")
+	expectLines(t, collect(t, h), "b")
+}
+
+func TestCollectAfterTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendTo(t, path, "")
+	h := newTestHandler(t, path)
+
+	appendTo(t, path, "first line\nsecond line\n")
+	expectLines(t, collect(t, h), "first line", "second line")
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendTo(t, path, "x\n")
+	expectLines(t, collect(t, h), "x")
+	appendTo(t, path, "y\n")
+	expectLines(t, collect(t, h), "y")
+}
+
+func TestCollectAfterTruncationPastOldPosition(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string // written before the handler starts, so skipped
+		before   string
+		after    string
+	}{
+		{"short lines", "", "a\nb\n", "first line after\nsecond line after\n"},
+		{"skipped lines", "old\n", "a\n", "new line, longer than before\n"},
+		{"past the checksummed head", "", strings.Repeat("x", 2000) + "\n", strings.Repeat("y", 3000) + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			appendTo(t, path, tt.existing)
+			h := newTestHandler(t, path)
+
+			appendTo(t, path, tt.before)
+			collect(t, h)
+
+			// rewritten past the old position before the next collection
+			if err := os.Truncate(path, 0); err != nil {
+				t.Fatal(err)
+			}
+			appendTo(t, path, tt.after)
+			expectLines(t, collect(t, h), strings.Split(strings.TrimSuffix(tt.after, "\n"), "\n")...)
+		})
+	}
+}
+
+func TestCollectEachLineOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendTo(t, path, "")
+	h := newTestHandler(t, path)
+
+	var got, want []string
+	for i := 0; i < 20; i++ {
+		line := strings.Repeat("x", i+1)
+		want = append(want, line)
+		appendTo(t, path, line+"\n")
+		if i%3 == 0 {
+			got = append(got, collect(t, h)...)
+			// nothing new, so a second call publishes nothing
+			got = append(got, collect(t, h)...)
+		}
+	}
+	got = append(got, collect(t, h)...)
+	got = append(got, collect(t, h)...)
+
+	expectLines(t, got, want...)
+}
+
+func TestCollectHoldsBackPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendTo(t, path, "")
+	h := newTestHandler(t, path)
+
+	appendTo(t, path, "complete\nhalf a ")
+	expectLines(t, collect(t, h), "complete")
+	expectLines(t, collect(t, h))
+
+	appendTo(t, path, "line\n")
+	expectLines(t, collect(t, h), "half a line")
+}
+
+func TestCollectFinishesPartialLineOfRotatedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendTo(t, path, "")
+	h := newTestHandler(t, path)
+
+	appendTo(t, path, "unfinished")
+	expectLines(t, collect(t, h))
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendTo(t, path, "next\n")
+	expectLines(t, collect(t, h), "unfinished", "next")
+}
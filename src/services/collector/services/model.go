@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"log"
+	"os"
 	"sync"
 
 	"github.com/fsnotify/fsnotify"
@@ -11,6 +12,10 @@ import (
 type LogFileHandler struct {
 	FilePath         string
 	LastPosition     int64
+	File             *os.File
+	FileInfo         os.FileInfo
+	HeadLen          int64  // how many bytes from the start HeadSum covers
+	HeadSum          uint32 // CRC-32 of the first HeadLen bytes read
 	Mu               sync.Mutex
 	Logger           *log.Logger
 	CentrifugoClient *CentrifugoClient
@@ -18,6 +18,7 @@ func NewLogCollectorService(config Config, logger *log.Logger, subject string) (
 
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("failed to create watcher: %w", err)
 	}
 
@@ -37,6 +38,8 @@ func NewLogCollectorService(config Config, logger *log.Logger, subject string) (
 	if config.Nats.URL != "" {
 		nc, err = nats.Connect(config.Nats.URL)
 		if err != nil {
+			cancel()
+			watcher.Close()
 			return nil, fmt.Errorf("failed to connect to nats: %w", err)
 		}
 	} else {
@@ -125,8 +128,8 @@ func (s *LogCollectorService) processEvents() {
 
 			//check if this is a file we are monitoring
 			if handler, exists := s.handlers[event.Name]; exists {
-				//only process write/create events
-				if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
+				//a rename or remove means the file was rotated away: drain what is left of it
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
 					if err := handler.CollectNewLogs(s.logger); err != nil {
 						s.logger.Printf("error collecting logs from %s: %v", event.Name, err)
 					}
@@ -153,6 +156,9 @@ func (s *LogCollectorService) Stop() {
 	}
 
 	s.wg.Wait()
+	for _, handler := range s.handlers {
+		handler.Close()
+	}
 	s.logger.Println("stopped all log monitoring")
 }
 
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// relative accuracy of the latency percentiles
+const sketchAccuracy = 0.01
+
+var (
+	sketchGamma    = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+type LatencyPercentiles struct {
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+	Samples int     `json:"samples"`
+}
+
+// Baseline is a service's duration baseline. Durations are scored on their
+// logarithm, so it is reported as the geometric mean in milliseconds and the
+// standard deviation of ln(duration).
+type Baseline struct {
+	GeometricMean float64 `json:"geometricMean"`
+	LogStdDev     float64 `json:"logStdDev"`
+	Samples       int     `json:"samples"`
+}
+
+// quantileSketch is a log-bucketed histogram in the style of DDSketch. Every
+// value lands in a bucket whose bounds are within sketchAccuracy of it, so
+// quantiles have bounded relative error and sketches merge by adding counts.
+type quantileSketch struct {
+	counts map[int]int
+	zeros  int
+	total  int
+}
+
+func newQuantileSketch() *quantileSketch {
+	return &quantileSketch{counts: make(map[int]int)}
+}
+
+func (q *quantileSketch) Add(value float64) {
+	q.total++
+	if value <= 0 {
+		q.zeros++
+		return
+	}
+	q.counts[int(math.Ceil(math.Log(value)/sketchLogGamma))]++
+}
+
+func (q *quantileSketch) Merge(other *quantileSketch) {
+	q.total += other.total
+	q.zeros += other.zeros
+	for idx, count := range other.counts {
+		q.counts[idx] += count
+	}
+}
+
+func (q *quantileSketch) Quantile(p float64) float64 {
+	if q.total == 0 {
+		return 0
+	}
+
+	rank := p * float64(q.total-1)
+	seen := q.zeros
+	if float64(seen) > rank {
+		return 0
+	}
+
+	indexes := make([]int, 0, len(q.counts))
+	for idx := range q.counts {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	for _, idx := range indexes {
+		seen += q.counts[idx]
+		if float64(seen) > rank {
+			// the midpoint of the bucket (gamma^(i-1), gamma^i]
+			return 2 * math.Pow(sketchGamma, float64(idx)) / (sketchGamma + 1)
+		}
+	}
+	return 2 * math.Pow(sketchGamma, float64(indexes[len(indexes)-1])) / (sketchGamma + 1)
+}
+
+func (q *quantileSketch) Percentiles() LatencyPercentiles {
+	return LatencyPercentiles{
+		P50:     q.Quantile(0.50),
+		P95:     q.Quantile(0.95),
+		P99:     q.Quantile(0.99),
+		Samples: q.total,
+	}
+}
+
+// ewmaBaseline tracks an exponentially weighted mean and variance, here of the
+// logarithm of a service's durations.
+type ewmaBaseline struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+// observe scores value against the baseline built so far and then folds it in.
+// The z-score is 0 until the baseline has warmup samples.
+func (b *ewmaBaseline) observe(value, alpha float64, warmup int) (z float64) {
+	if b.samples == 0 {
+		b.mean = value
+		b.samples++
+		return 0
+	}
+
+	std := math.Sqrt(b.variance)
+	if b.samples >= warmup && std > 0 {
+		z = (value - b.mean) / std
+	}
+
+	diff := value - b.mean
+	incr := alpha * diff
+	b.mean += incr
+	b.variance = (1 - alpha) * (b.variance + diff*incr)
+	b.samples++
+
+	return z
+}
+
+func (b *ewmaBaseline) snapshot() Baseline {
+	return Baseline{
+		GeometricMean: math.Exp(b.mean),
+		LogStdDev:     math.Sqrt(b.variance),
+		Samples:       b.samples,
+	}
+}
+
+// trackErrorBurst follows runs of ERROR/CRITICAL lines per service. A run ends
+// when the service logs anything else or goes quiet for longer than the burst
+// gap; runs of at least the burst minimum are kept as error sequences.
+func (s *StatsCollector) trackErrorBurst(ts time.Time, level, service string) {
+	if service == "" {
+		return
+	}
+
+	run, open := s.errorRuns[service]
+	if open && ts.Sub(run.EndTime) > s.burstGap {
+		s.closeErrorRun(service)
+		open = false
+	}
+
+	if level != ERROR && level != CRITICAL {
+		if open {
+			s.closeErrorRun(service)
+		}
+		return
+	}
+
+	if !open {
+		run = &ErrorSequence{StartTime: ts, Service: service}
+		s.errorRuns[service] = run
+	}
+	run.Count++
+	run.EndTime = ts
+}
+
+func (s *StatsCollector) closeErrorRun(service string) {
+	if run := s.errorRuns[service]; run.Count >= s.burstMin {
+		s.sequences = appendBounded(s.sequences, *run)
+	}
+	delete(s.errorRuns, service)
+}
+
+// trackDurationAnomaly scores a duration against its service's EWMA baseline
+// and records it when the z-score passes the configured threshold. Durations
+// are log-normal, so the score is taken on ln(duration): on the durations
+// themselves the long right tail of normal traffic would be flagged. duration
+// must be positive.
+func (s *StatsCollector) trackDurationAnomaly(ts time.Time, service string, duration int) {
+	baseline, ok := s.baselines[service]
+	if !ok {
+		baseline = &ewmaBaseline{}
+		s.baselines[service] = baseline
+	}
+
+	mean, std := baseline.mean, math.Sqrt(baseline.variance)
+
+	z := baseline.observe(math.Log(float64(duration)), s.ewmaAlpha, s.warmup)
+	if z > s.zThreshold {
+		s.anomalies = appendBounded(s.anomalies, Anomaly{
+			Timestamp:  ts,
+			Service:    service,
+			MetricName: "duration",
+			Value:      float64(duration),
+			Threshold:  math.Exp(mean + s.zThreshold*std),
+			Baseline:   math.Exp(mean),
+			ZScore:     z,
+		})
+	}
+}
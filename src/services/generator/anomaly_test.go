@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestQuantileSketchAccuracy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	draw := func(n int, f func() float64) []float64 {
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = f()
+		}
+		return values
+	}
+
+	tests := []struct {
+		name   string
+		values []float64
+	}{
+		{"uniform", draw(10000, func() float64 { return 1 + rng.Float64()*999 })},
+		{"log-normal", draw(10000, func() float64 { return 50 * math.Exp(1.2*rng.NormFloat64()) })},
+		{"exponential", draw(10000, func() float64 { return rng.ExpFloat64() * 100 })},
+		{"whole milliseconds", draw(10000, func() float64 { return math.Max(1, math.Round(50*math.Exp(0.8*rng.NormFloat64()))) })},
+		{"with zeros", draw(1000, func() float64 { return float64(rng.Intn(4)) * rng.Float64() * 10 })},
+		{"one value", []float64{42}},
+		{"wide range", draw(5000, func() float64 { return math.Pow(10, rng.Float64()*9-3) })},
+	}
+	quantiles := []float64{0, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.95, 0.99, 0.999, 1}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// half in each of two sketches, so merging is covered too
+			sketch, other := newQuantileSketch(), newQuantileSketch()
+			for i, v := range tt.values {
+				if i%2 == 0 {
+					sketch.Add(v)
+				} else {
+					other.Add(v)
+				}
+			}
+			sketch.Merge(other)
+
+			exact := append([]float64(nil), tt.values...)
+			sort.Float64s(exact)
+
+			for _, p := range quantiles {
+				want := exact[int(p*float64(len(exact)-1))]
+				got := sketch.Quantile(p)
+				if math.Abs(got-want) > sketchAccuracy*want+1e-9 {
+					t.Errorf("p%g: got %g, exact %g, relative error %.4f", p*100, got, want, math.Abs(got-want)/want)
+				}
+			}
+		})
+	}
+}
+
+func TestQuantileSketchEmpty(t *testing.T) {
+	if got := newQuantileSketch().Percentiles(); got != (LatencyPercentiles{}) {
+		t.Errorf("empty sketch: %+v", got)
+	}
+}
+
+func newAnomalyTestCollector() *StatsCollector {
+	return NewStatsCollector(newFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)), Config{
+		StatsBucketSeconds: 10,
+		StatsRetention:     60,
+		AnomalyZThreshold:  3,
+		AnomalyEWMAAlpha:   0.05,
+		AnomalyWarmup:      30,
+	})
+}
+
+// The long tail of log-normal durations is normal traffic, and only about as
+// much of it as a normal distribution has past three standard deviations may
+// be flagged, whatever the spread.
+func TestDurationAnomaliesOnLogNormalTraffic(t *testing.T) {
+	const n = 20000
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, sigma := range []float64{0.3, 0.8, 1.3} {
+		t.Run(fmt.Sprintf("sigma %g", sigma), func(t *testing.T) {
+			s := newAnomalyTestCollector()
+			rng := rand.New(rand.NewSource(1))
+			for i := 0; i < n; i++ {
+				duration := math.Max(1, math.Round(50*math.Exp(sigma*rng.NormFloat64())))
+				s.trackDurationAnomaly(ts, "user-service", int(duration))
+			}
+
+			if rate := float64(len(s.anomalies)) / n; rate > 0.005 {
+				t.Errorf("%.2f%% of normal durations flagged", rate*100)
+			}
+			baseline := s.baselines["user-service"].snapshot()
+			if baseline.GeometricMean < 40 || baseline.GeometricMean > 60 {
+				t.Errorf("geometric mean %g, want about 50", baseline.GeometricMean)
+			}
+		})
+	}
+}
+
+func TestDurationAnomalyFlagsSpike(t *testing.T) {
+	s := newAnomalyTestCollector()
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		s.trackDurationAnomaly(ts, "user-service", int(math.Max(1, math.Round(50*math.Exp(0.5*rng.NormFloat64())))))
+	}
+	before := len(s.anomalies)
+
+	s.trackDurationAnomaly(ts, "user-service", 5000)
+	if len(s.anomalies) != before+1 {
+		t.Fatal("a duration 100 times the median was not flagged")
+	}
+	a := s.anomalies[len(s.anomalies)-1]
+	if a.Value != 5000 || a.Threshold <= a.Baseline || a.Value <= a.Threshold {
+		t.Errorf("anomaly %+v", a)
+	}
+}
+
+func TestDurationAnomalyWarmup(t *testing.T) {
+	s := newAnomalyTestCollector()
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 29; i++ {
+		s.trackDurationAnomaly(ts, "user-service", 10+i%3)
+	}
+	s.trackDurationAnomaly(ts, "user-service", 10000)
+	if len(s.anomalies) != 0 {
+		t.Errorf("flagged during warmup: %+v", s.anomalies)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const backfillDateFormat = "2006-01-02"
+
+// backfillDay is one output file: the lines of one UTC day, counted per minute
+// so the day follows the traffic curve.
+type backfillDay struct {
+	Start  time.Time
+	End    time.Time
+	Counts []int
+	Total  int
+	Seed   int64
+}
+
+// runBackfill writes count log events stamped between --from and --to into one
+// file per day under --out, as fast as the generator can produce them:
+//
+//	generator backfill --from 2026-09-01 --to 2026-09-30 --count 5000000 --out data/
+//
+// The rest of the configuration (formats, services, levels, faults, PII, attacks) comes
+// from the environment as usual. An event is what one live tick emits, so a trace
+// or a stack trace is one event over several lines, and faults can add lines.
+// Bursts, scenarios and cascading failures are driven by the live run loop and
+// never happen in a backfill.
+func runBackfill(args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fromFlag := flags.String("from", "", "first day (YYYY-MM-DD) or instant (RFC 3339) to stamp")
+	toFlag := flags.String("to", "", "last day (YYYY-MM-DD, included) or instant (RFC 3339, excluded) to stamp")
+	count := flags.Int("count", 0, "number of log events to write")
+	out := flags.String("out", "data", "directory the daily files are written to")
+	workers := flags.Int("workers", runtime.NumCPU(), "days generated in parallel")
+	seed := flags.Int64("seed", 0, "random seed, SEED when 0")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	from, err := parseBackfillTime(*fromFlag, false)
+	if err != nil {
+		return fmt.Errorf("invalid --from: %w", err)
+	}
+	to, err := parseBackfillTime(*toFlag, true)
+	if err != nil {
+		return fmt.Errorf("invalid --to: %w", err)
+	}
+	if !to.After(from) {
+		return fmt.Errorf("--to must be after --from")
+	}
+	if *count <= 0 {
+		return fmt.Errorf("--count must be positive")
+	}
+	if *workers < 1 {
+		*workers = 1
+	}
+
+	cfg := LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if *seed == 0 {
+		*seed = cfg.Seed
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	if err := os.MkdirAll(*out, 0777); err != nil {
+		return fmt.Errorf("failed to create %s: %w", *out, err)
+	}
+
+	curve, err := cfg.TrafficCurve()
+	if err != nil {
+		return err
+	}
+
+	days := planBackfill(from, to, *count, *seed, curve)
+	fmt.Printf("Backfilling %d events from %s to %s into %d files in %s\n",
+		*count, from.Format(time.RFC3339), to.Format(time.RFC3339), len(days), *out)
+
+	began := time.Now()
+	var written atomic.Int64
+	var firstErr error
+	var errOnce sync.Once
+
+	jobs := make(chan backfillDay)
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for day := range jobs {
+				n, err := backfillFile(cfg, day, *out)
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+					continue
+				}
+				written.Add(int64(n))
+			}
+		}()
+	}
+	for _, day := range days {
+		jobs <- day
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	elapsed := time.Since(began)
+	fmt.Printf("Wrote %d events as %d lines in %s (%.0f lines/s)\n",
+		*count, written.Load(), elapsed.Round(time.Millisecond), float64(written.Load())/elapsed.Seconds())
+	return nil
+}
+
+// parseBackfillTime reads a date or an RFC 3339 instant. A date used as the end
+// of the range covers the whole of that day.
+func parseBackfillTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("a date is required")
+	}
+	if t, err := time.Parse(backfillDateFormat, value); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// planBackfill splits count events over the minutes between from and to in
+// proportion to the traffic curve, and groups the minutes by UTC day.
+func planBackfill(from, to time.Time, count int, seed int64, curve TrafficCurve) []backfillDay {
+	from, to = from.UTC(), to.UTC()
+
+	var days []backfillDay
+	var weights []float64
+	total := 0.0
+	for dayStart := from; dayStart.Before(to); {
+		dayEnd := dayStart.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		if dayEnd.After(to) {
+			dayEnd = to
+		}
+		day := backfillDay{Start: dayStart, End: dayEnd, Seed: seed + int64(len(days))}
+		for m := dayStart; m.Before(dayEnd); m = m.Add(time.Minute) {
+			slot := min(time.Minute, dayEnd.Sub(m))
+			w := curve.Factor(m.Add(slot/2)) * slot.Seconds()
+			weights = append(weights, w)
+			total += w
+			day.Counts = append(day.Counts, 0)
+		}
+		days = append(days, day)
+		dayStart = dayEnd
+	}
+
+	// round the running total so the minutes add up to count exactly
+	cum, assigned, i := 0.0, 0, 0
+	for d := range days {
+		for m := range days[d].Counts {
+			cum += weights[i] / total * float64(count)
+			n := int(math.Round(cum)) - assigned
+			days[d].Counts[m] = n
+			days[d].Total += n
+			assigned += n
+			i++
+		}
+	}
+	return days
+}
+
+// backfillFile writes one day's events, in time order, to <out>/<date>.log and
+// returns how many lines that took.
+func backfillFile(base Config, day backfillDay, out string) (int, error) {
+	name := day.Start.Format(backfillDateFormat)
+	path := filepath.Join(out, name+".log")
+
+	cfg := base
+	cfg.OutputFile = ""
+	cfg.OutputLayout = layoutShared
+	cfg.ConsoleOutput = false
+	cfg.Seed = day.Seed
+	cfg.FakeClockStart = day.Start.Format(time.RFC3339)
+	if cfg.FaultRate > 0 {
+		cfg.FaultManifestFile = filepath.Join(out, name+".faults.jsonl")
+	}
+	if cfg.PIIRate > 0 {
+		cfg.PIIManifestFile = filepath.Join(out, name+".pii.jsonl")
+	}
+	if cfg.SecurityRate > 0 {
+		cfg.SecurityManifestFile = filepath.Join(out, name+".security.jsonl")
+	}
+	// manifests are appended to, so clear the ones left by an earlier backfill
+	for _, manifest := range []string{cfg.FaultManifestFile, cfg.PIIManifestFile, cfg.SecurityManifestFile} {
+		if manifest != "" {
+			if err := os.Remove(manifest); err != nil && !os.IsNotExist(err) {
+				return 0, fmt.Errorf("failed to remove old manifest %s: %w", manifest, err)
+			}
+		}
+	}
+	lg, err := NewLogGenerator(cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer lg.output.Close()
+	defer lg.closeManifests()
+	clock := lg.clock.(*fakeClock)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+	w := bufio.NewWriterSize(file, outputBufSize)
+
+	written := 0
+	write := func(entries []routedEntry) error {
+		for _, entry := range entries {
+			if _, err := w.WriteString(entry.text + "\n"); err != nil {
+				return fmt.Errorf("failed to write %s: %w", path, err)
+			}
+			written += strings.Count(entry.text, "\n") + 1
+		}
+		return nil
+	}
+
+	for m, n := range day.Counts {
+		slotStart := day.Start.Add(time.Duration(m) * time.Minute)
+		slot := min(time.Minute, day.End.Sub(slotStart))
+		for i := 0; i < n; i++ {
+			// spread the minute's lines evenly, jittered within their share
+			offset := (float64(i) + lg.rng.Float64()) / float64(n)
+			clock.Set(slotStart.Add(time.Duration(offset * float64(slot))))
+
+			if err := write(lg.injectFaults(lg.generateLogMessage())); err != nil {
+				return written, err
+			}
+		}
+	}
+	if lg.faults != nil {
+		if err := write(lg.faults.drain()); err != nil {
+			return written, err
+		}
+	}
+
+	if lg.security != nil {
+		lg.security.finish()
+	}
+
+	if err := w.Flush(); err != nil {
+		return written, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Printf("  %s: %d events, %d lines\n", path, day.Total, written)
+	return written, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanBackfillSumsToCount(t *testing.T) {
+	day := func(s string) time.Time {
+		t, _ := time.Parse(time.RFC3339, s)
+		return t
+	}
+	weekend := TrafficCurve{PeakHour: 9, Amplitude: 0.9, WeekendFactor: 0.2, Location: time.UTC}
+
+	tests := []struct {
+		name  string
+		from  time.Time
+		to    time.Time
+		count int
+		curve TrafficCurve
+		days  int
+	}{
+		{"one day", day("2026-09-01T00:00:00Z"), day("2026-09-02T00:00:00Z"), 100000, defaultTrafficCurve, 1},
+		{"a month", day("2026-09-01T00:00:00Z"), day("2026-10-01T00:00:00Z"), 5000003, defaultTrafficCurve, 30},
+		{"fewer events than minutes", day("2026-09-01T00:00:00Z"), day("2026-09-03T00:00:00Z"), 7, defaultTrafficCurve, 2},
+		{"partial days", day("2026-09-01T22:30:30Z"), day("2026-09-03T01:15:10Z"), 9999, defaultTrafficCurve, 3},
+		{"a week with quiet weekends", day("2026-09-01T00:00:00Z"), day("2026-09-08T00:00:00Z"), 123457, weekend, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days := planBackfill(tt.from, tt.to, tt.count, 1, tt.curve)
+			if len(days) != tt.days {
+				t.Fatalf("planned %d days, want %d", len(days), tt.days)
+			}
+			if !days[0].Start.Equal(tt.from) || !days[len(days)-1].End.Equal(tt.to) {
+				t.Errorf("days cover %s to %s, want %s to %s", days[0].Start, days[len(days)-1].End, tt.from, tt.to)
+			}
+
+			total := 0
+			for _, d := range days {
+				sum := 0
+				for _, n := range d.Counts {
+					if n < 0 {
+						t.Fatalf("%s: negative minute count %d", d.Start, n)
+					}
+					sum += n
+				}
+				if sum != d.Total {
+					t.Errorf("%s: minutes add up to %d, day total is %d", d.Start, sum, d.Total)
+				}
+				total += sum
+			}
+			if total != tt.count {
+				t.Errorf("planned %d events, want %d", total, tt.count)
+			}
+		})
+	}
+}
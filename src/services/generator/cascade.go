@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// how many ended failures GET /failures keeps reporting
+	maxFailureHistory = 50
+
+	// the share of a failing service's lines that report the failure, and how
+	// much of that share is left at each hop further upstream
+	failureLineShare = 0.9
+	cascadeDecay     = 0.6
+
+	// how often random failures are considered
+	failureCheckInterval = time.Second
+)
+
+var failureMessages = []string{
+	"Connection refused while accepting requests",
+	"Health check failed: dependency pool exhausted",
+	"Request handler crashed: out of memory",
+	"Database connection pool exhausted (0 of 50 available)",
+}
+
+// messages upstream of a failure, given the dependency and how long the call took in ms
+var cascadeMessages = map[string][]string{
+	WARNING: {
+		"Slow response from %s, took %dms",
+		"Retrying request to %s, no answer after %dms",
+		"Falling back to cached data, %s did not answer within %dms",
+	},
+	ERROR: {
+		"Call to %s timed out after %dms",
+		"Circuit breaker opened for %s, last call took %dms",
+		"Upstream %s returned 503 Service Unavailable after %dms",
+	},
+}
+
+// ServiceFailure is a failure injected into one service. Every service that
+// calls it, directly or through others, is affected CASCADE_LAG seconds per
+// hop later and recovers as long after the failure ends.
+type ServiceFailure struct {
+	ID       string            `json:"id"`
+	Service  string            `json:"service"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Impacted []ImpactedService `json:"impacted"`
+}
+
+// ImpactedService is one service a failure reaches. Via is the dependency the
+// failure arrives through, and Hops how far the failed service is.
+type ImpactedService struct {
+	Service string    `json:"service"`
+	Via     string    `json:"via,omitempty"`
+	Hops    int       `json:"hops"`
+	From    time.Time `json:"from"`
+	Until   time.Time `json:"until"`
+}
+
+type FailureRequest struct {
+	Service  string  `json:"service"`
+	Duration float64 `json:"duration"`
+}
+
+// InjectFailure fails service for duration, starting now.
+func (lg *LogGenerator) InjectFailure(service string, duration time.Duration) (ServiceFailure, error) {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	if !contains(lg.cfg.Services, service) && !lg.callGraph.has(service) {
+		return ServiceFailure{}, fmt.Errorf("unknown service %q", service)
+	}
+	if duration <= 0 {
+		return ServiceFailure{}, fmt.Errorf("duration must be positive")
+	}
+	return *lg.startFailure(service, lg.clock.Now(), duration), nil
+}
+
+// Failures returns the failures still affecting some service, then the most
+// recent ended ones.
+func (lg *LogGenerator) Failures() []ServiceFailure {
+	lg.mu.RLock()
+	defer lg.mu.RUnlock()
+
+	failures := make([]ServiceFailure, 0, len(lg.failures)+len(lg.failureHistory))
+	for _, f := range lg.failures {
+		failures = append(failures, *f)
+	}
+	for i := len(lg.failureHistory) - 1; i >= 0; i-- {
+		failures = append(failures, *lg.failureHistory[i])
+	}
+	return failures
+}
+
+// startFailure records a failure and works out when it reaches each caller.
+// The caller holds lg.mu.
+func (lg *LogGenerator) startFailure(service string, start time.Time, duration time.Duration) *ServiceFailure {
+	lg.failureCount++
+	f := &ServiceFailure{
+		ID:      fmt.Sprintf("failure-%d", lg.failureCount),
+		Service: service,
+		Start:   start,
+		End:     start.Add(duration),
+	}
+
+	lag := time.Duration(lg.cfg.CascadeLag * float64(time.Second))
+	for _, impact := range lg.callGraph.callersOf(service) {
+		impact.From = f.Start.Add(time.Duration(impact.Hops) * lag)
+		impact.Until = f.End.Add(time.Duration(impact.Hops) * lag)
+		f.Impacted = append(f.Impacted, impact)
+	}
+
+	fmt.Printf("Failure %s: %s fails for %s, reaching %d services\n", f.ID, service, duration, len(f.Impacted)-1)
+	lg.failures = append(lg.failures, f)
+	return f
+}
+
+// tickFailures starts random failures at CASCADE_FAILURE_RATE and retires the
+// ones that no longer affect any service. The caller holds lg.mu.
+func (lg *LogGenerator) tickFailures(now time.Time) {
+	active := lg.failures[:0]
+	for _, f := range lg.failures {
+		if now.Before(f.Impacted[len(f.Impacted)-1].Until) {
+			active = append(active, f)
+			continue
+		}
+		lg.failureHistory = append(lg.failureHistory, f)
+		if len(lg.failureHistory) > maxFailureHistory {
+			lg.failureHistory = lg.failureHistory[1:]
+		}
+	}
+	lg.failures = active
+
+	if lg.cfg.CascadeFailureRate <= 0 {
+		return
+	}
+	elapsed := now.Sub(lg.failureCheckAt)
+	if lg.failureCheckAt.IsZero() || elapsed < 0 {
+		lg.failureCheckAt = now
+		return
+	}
+	if elapsed < failureCheckInterval {
+		return
+	}
+	lg.failureCheckAt = now
+
+	// only services something depends on can cascade
+	downstream := lg.callGraph.callees()
+	if len(downstream) == 0 {
+		return
+	}
+	if lg.rng.Float64() < lg.cfg.CascadeFailureRate/3600*elapsed.Seconds() {
+		service := downstream[lg.rng.Intn(len(downstream))]
+		lg.startFailure(service, now, time.Duration(lg.cfg.CascadeFailureDuration*float64(time.Second)))
+	}
+}
+
+// retireFailures moves every failure still going into the history, so it
+// does not outlive the run that started it.
+func (lg *LogGenerator) retireFailures() {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	for _, f := range lg.failures {
+		lg.failureHistory = append(lg.failureHistory, f)
+	}
+	if len(lg.failureHistory) > maxFailureHistory {
+		lg.failureHistory = lg.failureHistory[len(lg.failureHistory)-maxFailureHistory:]
+	}
+	lg.failures = nil
+	lg.failureCheckAt = time.Time{}
+}
+
+// cascadeImpact returns the closest failure affecting service at now.
+func (lg *LogGenerator) cascadeImpact(service string, now time.Time) (ImpactedService, bool) {
+	var found ImpactedService
+	ok := false
+	for _, f := range lg.failures {
+		for _, impact := range f.Impacted {
+			if impact.Service != service || now.Before(impact.From) || !now.Before(impact.Until) {
+				continue
+			}
+			if !ok || impact.Hops < found.Hops {
+				found, ok = impact, true
+			}
+		}
+	}
+	return found, ok
+}
+
+// cascadeLine decides whether a line from service reports a failure, and
+// returns its level and message if so.
+func (lg *LogGenerator) cascadeLine(service string) (string, string, bool) {
+	impact, ok := lg.cascadeImpact(service, lg.clock.Now())
+	if !ok || lg.rng.Float64() >= failureLineShare*math.Pow(cascadeDecay, float64(impact.Hops)) {
+		return "", "", false
+	}
+
+	if impact.Hops == 0 {
+		level := ERROR
+		if lg.rng.Float64() < 0.1 {
+			level = CRITICAL
+		}
+		return level, failureMessages[lg.rng.Intn(len(failureMessages))], true
+	}
+
+	// callers right next to the failure see errors, further up mostly slowness
+	level := WARNING
+	if lg.rng.Float64() < 0.7*math.Pow(cascadeDecay, float64(impact.Hops-1)) {
+		level = ERROR
+	}
+	messages := cascadeMessages[level]
+	message := messages[lg.rng.Intn(len(messages))]
+	// the call gave up or came back around a client timeout
+	return level, fmt.Sprintf(message, impact.Via, lg.rng.Intn(4000)+1000), true
+}
+
+// cascadeLatency stretches a duration in milliseconds for a service a failure
+// has reached: by CASCADE_LATENCY_FACTOR at the failed service, less at each
+// hop upstream.
+func (lg *LogGenerator) cascadeLatency(service string, duration int) int {
+	impact, ok := lg.cascadeImpact(service, lg.clock.Now())
+	if !ok {
+		return duration
+	}
+	factor := 1 + (lg.cfg.CascadeLatencyFactor-1)*math.Pow(cascadeDecay, float64(impact.Hops))
+	return int(float64(duration) * factor)
+}
+
+func (g CallGraph) has(service string) bool {
+	if _, ok := g[service]; ok {
+		return true
+	}
+	for _, callees := range g {
+		if contains(callees, service) {
+			return true
+		}
+	}
+	return false
+}
+
+// callees returns every service some other service calls, sorted.
+func (g CallGraph) callees() []string {
+	seen := make(map[string]bool)
+	var services []string
+	for _, callees := range g {
+		for _, callee := range callees {
+			if !seen[callee] {
+				seen[callee] = true
+				services = append(services, callee)
+			}
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// callersOf walks the graph upstream from service, breadth first, and returns
+// service itself followed by everything that depends on it with the fewest
+// hops to it.
+func (g CallGraph) callersOf(service string) []ImpactedService {
+	callers := make(map[string][]string)
+	for caller, callees := range g {
+		for _, callee := range callees {
+			callers[callee] = append(callers[callee], caller)
+		}
+	}
+
+	impacted := []ImpactedService{{Service: service}}
+	seen := map[string]bool{service: true}
+	for i := 0; i < len(impacted); i++ {
+		current := impacted[i]
+		next := callers[current.Service]
+		sort.Strings(next)
+		for _, caller := range next {
+			if seen[caller] {
+				continue
+			}
+			seen[caller] = true
+			impacted = append(impacted, ImpactedService{Service: caller, Via: current.Service, Hops: current.Hops + 1})
+		}
+	}
+	return impacted
+}
@@ -1,6 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -32,9 +37,97 @@ type Config struct {
 	BurstFrequency  float64  `json:"BURST_FREQUENCY"`
 	BurstMultiplier int      `json:"BURST_MULTIPLIER"`
 	BurstDuration   float64  `json:"BURST_DURATION"`
+
+	ScenarioFile string `json:"SCENARIO_FILE"`
+
+	Seed           int64   `json:"SEED"`
+	FakeClockStart string  `json:"FAKE_CLOCK_START"`
+	RunDuration    float64 `json:"RUN_DURATION"`
+
+	StackTraceProbability float64  `json:"STACK_TRACE_PROBABILITY"`
+	StackTraceDepth       int      `json:"STACK_TRACE_DEPTH"`
+	StackTraceStyles      []string `json:"STACK_TRACE_STYLES"`
+
+	TraceProbability float64 `json:"TRACE_PROBABILITY"`
+	TraceCallGraph   string  `json:"TRACE_CALL_GRAPH"`
+
+	ActiveUsers      int    `json:"ACTIVE_USERS"`
+	JourneyModelFile string `json:"JOURNEY_MODEL_FILE"`
+
+	MessageTemplatesFile string `json:"MESSAGE_TEMPLATES_FILE"`
+
+	StatsRetention     int `json:"STATS_RETENTION"`
+	StatsBucketSeconds int `json:"STATS_BUCKET_SECONDS"`
+
+	AnomalyZThreshold float64 `json:"ANOMALY_Z_THRESHOLD"`
+	AnomalyEWMAAlpha  float64 `json:"ANOMALY_EWMA_ALPHA"`
+	AnomalyWarmup     int     `json:"ANOMALY_WARMUP"`
+	ErrorBurstMin     int     `json:"ERROR_BURST_MIN"`
+	ErrorBurstGap     float64 `json:"ERROR_BURST_GAP"`
+
+	ReplayFile              string  `json:"REPLAY_FILE"`
+	ReplaySpeed             float64 `json:"REPLAY_SPEED"`
+	ReplayRewriteTimestamps bool    `json:"REPLAY_REWRITE_TIMESTAMPS"`
+
+	Workers int `json:"WORKERS"`
+
+	FaultRate          float64  `json:"FAULT_RATE"`
+	FaultTypes         []string `json:"FAULT_TYPES"`
+	FaultManifestFile  string   `json:"FAULT_MANIFEST_FILE"`
+	FaultClockSkew     float64  `json:"FAULT_CLOCK_SKEW"`
+	FaultOversizeBytes int      `json:"FAULT_OVERSIZE_BYTES"`
+
+	PIIRate         float64  `json:"PII_RATE"`
+	PIITypes        []string `json:"PII_TYPES"`
+	PIIManifestFile string   `json:"PII_MANIFEST_FILE"`
+
+	TrafficCurveEnabled  bool    `json:"TRAFFIC_CURVE"`
+	TrafficPeakHour      float64 `json:"TRAFFIC_PEAK_HOUR"`
+	TrafficAmplitude     float64 `json:"TRAFFIC_AMPLITUDE"`
+	TrafficWeekendFactor float64 `json:"TRAFFIC_WEEKEND_FACTOR"`
+	TrafficNoise         float64 `json:"TRAFFIC_NOISE"`
+	TrafficTimezone      string  `json:"TRAFFIC_TIMEZONE"`
+
+	LatencyP50          float64 `json:"LATENCY_P50"`
+	LatencyP99          float64 `json:"LATENCY_P99"`
+	HTTPErrorRate       float64 `json:"HTTP_ERROR_RATE"`
+	HTTPClientErrorRate float64 `json:"HTTP_CLIENT_ERROR_RATE"`
+	BurstErrorFactor    float64 `json:"BURST_ERROR_FACTOR"`
+	HTTPProfileFile     string  `json:"HTTP_PROFILE_FILE"`
+
+	SecurityRate         float64  `json:"SECURITY_RATE"`
+	SecurityTypes        []string `json:"SECURITY_TYPES"`
+	SecurityManifestFile string   `json:"SECURITY_MANIFEST_FILE"`
+
+	CascadeFailureRate     float64 `json:"CASCADE_FAILURE_RATE"`
+	CascadeFailureDuration float64 `json:"CASCADE_FAILURE_DURATION"`
+	CascadeLag             float64 `json:"CASCADE_LAG"`
+	CascadeLatencyFactor   float64 `json:"CASCADE_LATENCY_FACTOR"`
+
+	HostCount    int    `json:"HOST_COUNT"`
+	HostPrefix   string `json:"HOST_PREFIX"`
+	OutputLayout string `json:"OUTPUT_LAYOUT"`
+	OutputDir    string `json:"OUTPUT_DIR"`
 }
 
+// LoadConfig reads the configuration from the environment.
 func LoadConfig() Config {
+	configMu.Lock()
+	defer configMu.Unlock()
+	return loadConfig()
+}
+
+// DefaultConfig is the configuration of an empty environment.
+func DefaultConfig() Config {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	lookupEnv = func(string) (string, bool) { return "", false }
+	defer func() { lookupEnv = os.LookupEnv }()
+	return loadConfig()
+}
+
+func loadConfig() Config {
 
 	//setting up my defaults
 	defaultRate := 5
@@ -64,6 +157,76 @@ func LoadConfig() Config {
 	burstFrequency := getEnvAsFloat("BURST_FREQUENCY", 0.05)
 	burstMultiplier := getEnvAsInt("BURST_MULTIPLIER", 5)
 
+	scenarioFile := getEnv("SCENARIO_FILE", "")
+
+	seed := int64(getEnvAsInt("SEED", 0))
+	fakeClockStart := getEnv("FAKE_CLOCK_START", "")
+	runDuration := getEnvAsFloat("RUN_DURATION", 0)
+
+	stackTraceProbability := getEnvAsFloat("STACK_TRACE_PROBABILITY", 0)
+	stackTraceDepth := getEnvAsInt("STACK_TRACE_DEPTH", 8)
+	stackTraceStyles := getEnvAsSlice("STACK_TRACE_STYLES", stackTraceStyles, ",")
+
+	traceProbability := getEnvAsFloat("TRACE_PROBABILITY", 0)
+	traceCallGraph := getEnv("TRACE_CALL_GRAPH", defaultTraceCallGraph)
+
+	activeUsers := getEnvAsInt("ACTIVE_USERS", 50)
+	journeyModelFile := getEnv("JOURNEY_MODEL_FILE", "")
+	messageTemplatesFile := getEnv("MESSAGE_TEMPLATES_FILE", "")
+
+	statsRetention := getEnvAsInt("STATS_RETENTION", 3600)
+	statsBucketSeconds := getEnvAsInt("STATS_BUCKET_SECONDS", 10)
+
+	anomalyZThreshold := getEnvAsFloat("ANOMALY_Z_THRESHOLD", 3.0)
+	anomalyEWMAAlpha := getEnvAsFloat("ANOMALY_EWMA_ALPHA", 0.05)
+	anomalyWarmup := getEnvAsInt("ANOMALY_WARMUP", 30)
+	errorBurstMin := getEnvAsInt("ERROR_BURST_MIN", 3)
+	errorBurstGap := getEnvAsFloat("ERROR_BURST_GAP", 10.0)
+
+	replayFile := getEnv("REPLAY_FILE", "")
+	replaySpeed := getEnvAsFloat("REPLAY_SPEED", 1.0)
+	replayRewriteTimestamps := getEnvAsBool("REPLAY_REWRITE_TIMESTAMPS", false)
+
+	workers := getEnvAsInt("WORKERS", 1)
+
+	faultRate := getEnvAsFloat("FAULT_RATE", 0)
+	faultTypes := getEnvAsSlice("FAULT_TYPES", faultKinds, ",")
+	faultManifestFile := getEnv("FAULT_MANIFEST_FILE", "")
+	faultClockSkew := getEnvAsFloat("FAULT_CLOCK_SKEW", 300)
+	faultOversizeBytes := getEnvAsInt("FAULT_OVERSIZE_BYTES", 70000)
+
+	piiRate := getEnvAsFloat("PII_RATE", 0)
+	piiTypes := getEnvAsSlice("PII_TYPES", piiKinds, ",")
+	piiManifestFile := getEnv("PII_MANIFEST_FILE", "")
+
+	trafficCurve := getEnvAsBool("TRAFFIC_CURVE", false)
+	trafficPeakHour := getEnvAsFloat("TRAFFIC_PEAK_HOUR", defaultTrafficCurve.PeakHour)
+	trafficAmplitude := getEnvAsFloat("TRAFFIC_AMPLITUDE", defaultTrafficCurve.Amplitude)
+	trafficWeekendFactor := getEnvAsFloat("TRAFFIC_WEEKEND_FACTOR", 0.5)
+	trafficNoise := getEnvAsFloat("TRAFFIC_NOISE", 0.1)
+	trafficTimezone := getEnv("TRAFFIC_TIMEZONE", "UTC")
+
+	latencyP50 := getEnvAsFloat("LATENCY_P50", 40)
+	latencyP99 := getEnvAsFloat("LATENCY_P99", 600)
+	httpErrorRate := getEnvAsFloat("HTTP_ERROR_RATE", 0.01)
+	httpClientErrorRate := getEnvAsFloat("HTTP_CLIENT_ERROR_RATE", 0.04)
+	burstErrorFactor := getEnvAsFloat("BURST_ERROR_FACTOR", 3)
+	httpProfileFile := getEnv("HTTP_PROFILE_FILE", "")
+
+	securityRate := getEnvAsFloat("SECURITY_RATE", 0)
+	securityTypes := getEnvAsSlice("SECURITY_TYPES", securityKinds, ",")
+	securityManifestFile := getEnv("SECURITY_MANIFEST_FILE", "")
+
+	cascadeFailureRate := getEnvAsFloat("CASCADE_FAILURE_RATE", 0)
+	cascadeFailureDuration := getEnvAsFloat("CASCADE_FAILURE_DURATION", 60)
+	cascadeLag := getEnvAsFloat("CASCADE_LAG", 5)
+	cascadeLatencyFactor := getEnvAsFloat("CASCADE_LATENCY_FACTOR", 8)
+
+	hostCount := getEnvAsInt("HOST_COUNT", 0)
+	hostPrefix := getEnv("HOST_PREFIX", "host")
+	outputLayout := getEnv("OUTPUT_LAYOUT", layoutShared)
+	outputDir := getEnv("OUTPUT_DIR", filepath.Dir(outputFile))
+
 	return Config{
 		LogRate:         rate,
 		LogTypes:        types,
@@ -76,5 +239,421 @@ func LoadConfig() Config {
 		BurstFrequency:  burstFrequency,
 		BurstMultiplier: burstMultiplier,
 		BurstDuration:   burstDuration,
+		ScenarioFile:    scenarioFile,
+		Seed:            seed,
+		FakeClockStart:  fakeClockStart,
+		RunDuration:     runDuration,
+
+		StackTraceProbability: stackTraceProbability,
+		StackTraceDepth:       stackTraceDepth,
+		StackTraceStyles:      stackTraceStyles,
+
+		TraceProbability: traceProbability,
+		TraceCallGraph:   traceCallGraph,
+
+		ActiveUsers:      activeUsers,
+		JourneyModelFile: journeyModelFile,
+
+		MessageTemplatesFile: messageTemplatesFile,
+
+		StatsRetention:     statsRetention,
+		StatsBucketSeconds: statsBucketSeconds,
+
+		AnomalyZThreshold: anomalyZThreshold,
+		AnomalyEWMAAlpha:  anomalyEWMAAlpha,
+		AnomalyWarmup:     anomalyWarmup,
+		ErrorBurstMin:     errorBurstMin,
+		ErrorBurstGap:     errorBurstGap,
+
+		ReplayFile:              replayFile,
+		ReplaySpeed:             replaySpeed,
+		ReplayRewriteTimestamps: replayRewriteTimestamps,
+
+		Workers: workers,
+
+		FaultRate:          faultRate,
+		FaultTypes:         faultTypes,
+		FaultManifestFile:  faultManifestFile,
+		FaultClockSkew:     faultClockSkew,
+		FaultOversizeBytes: faultOversizeBytes,
+
+		PIIRate:         piiRate,
+		PIITypes:        piiTypes,
+		PIIManifestFile: piiManifestFile,
+
+		TrafficCurveEnabled:  trafficCurve,
+		TrafficPeakHour:      trafficPeakHour,
+		TrafficAmplitude:     trafficAmplitude,
+		TrafficWeekendFactor: trafficWeekendFactor,
+		TrafficNoise:         trafficNoise,
+		TrafficTimezone:      trafficTimezone,
+
+		LatencyP50:          latencyP50,
+		LatencyP99:          latencyP99,
+		HTTPErrorRate:       httpErrorRate,
+		HTTPClientErrorRate: httpClientErrorRate,
+		BurstErrorFactor:    burstErrorFactor,
+		HTTPProfileFile:     httpProfileFile,
+
+		SecurityRate:         securityRate,
+		SecurityTypes:        securityTypes,
+		SecurityManifestFile: securityManifestFile,
+
+		CascadeFailureRate:     cascadeFailureRate,
+		CascadeFailureDuration: cascadeFailureDuration,
+		CascadeLag:             cascadeLag,
+		CascadeLatencyFactor:   cascadeLatencyFactor,
+
+		HostCount:    hostCount,
+		HostPrefix:   hostPrefix,
+		OutputLayout: outputLayout,
+		OutputDir:    outputDir,
+	}
+}
+
+// Validate checks the settings that can be changed on a running generator.
+func (c Config) Validate() error {
+	if c.LogRate <= 0 {
+		return fmt.Errorf("LOG_RATE must be positive")
+	}
+
+	if len(c.Services) == 0 {
+		return fmt.Errorf("SERVICES must not be empty")
+	}
+	for _, service := range c.Services {
+		if strings.TrimSpace(service) == "" {
+			return fmt.Errorf("SERVICES must not contain empty names")
+		}
+	}
+
+	if err := validateDistribution(c.LogDistribution); err != nil {
+		return fmt.Errorf("LOG_DISTRIBUTION: %w", err)
+	}
+
+	if _, err := ParseLogFormat(c.LogFormat); err != nil {
+		return fmt.Errorf("LOG_FORMAT: %w", err)
+	}
+
+	if c.BurstFrequency < 0 || c.BurstFrequency > 1 {
+		return fmt.Errorf("BURST_FREQUENCY must be between 0 and 1")
+	}
+	if c.BurstMultiplier < 1 {
+		return fmt.Errorf("BURST_MULTIPLIER must be at least 1")
+	}
+	if c.BurstDuration < 0 {
+		return fmt.Errorf("BURST_DURATION must not be negative")
+	}
+
+	if c.StackTraceProbability < 0 || c.StackTraceProbability > 1 {
+		return fmt.Errorf("STACK_TRACE_PROBABILITY must be between 0 and 1")
+	}
+	if c.StackTraceDepth < 1 {
+		return fmt.Errorf("STACK_TRACE_DEPTH must be at least 1")
+	}
+	for _, style := range c.StackTraceStyles {
+		if !contains(stackTraceStyles, style) {
+			return fmt.Errorf("STACK_TRACE_STYLES: unknown style %q, expected one of %s", style, strings.Join(stackTraceStyles, ", "))
+		}
+	}
+
+	if c.TraceProbability < 0 || c.TraceProbability > 1 {
+		return fmt.Errorf("TRACE_PROBABILITY must be between 0 and 1")
+	}
+	if _, err := ParseCallGraph(c.TraceCallGraph); err != nil {
+		return fmt.Errorf("TRACE_CALL_GRAPH: %w", err)
+	}
+
+	if c.ActiveUsers < 1 {
+		return fmt.Errorf("ACTIVE_USERS must be at least 1")
+	}
+
+	if c.StatsBucketSeconds < 1 {
+		return fmt.Errorf("STATS_BUCKET_SECONDS must be at least 1")
+	}
+	if c.StatsRetention < c.StatsBucketSeconds {
+		return fmt.Errorf("STATS_RETENTION must be at least STATS_BUCKET_SECONDS")
+	}
+
+	if c.AnomalyZThreshold <= 0 {
+		return fmt.Errorf("ANOMALY_Z_THRESHOLD must be positive")
+	}
+	if c.AnomalyEWMAAlpha <= 0 || c.AnomalyEWMAAlpha > 1 {
+		return fmt.Errorf("ANOMALY_EWMA_ALPHA must be in (0, 1]")
+	}
+	if c.AnomalyWarmup < 1 {
+		return fmt.Errorf("ANOMALY_WARMUP must be at least 1")
+	}
+	if c.ErrorBurstMin < 1 {
+		return fmt.Errorf("ERROR_BURST_MIN must be at least 1")
+	}
+	if c.ErrorBurstGap <= 0 {
+		return fmt.Errorf("ERROR_BURST_GAP must be positive")
 	}
+
+	if c.ReplaySpeed < 0 {
+		return fmt.Errorf("REPLAY_SPEED must not be negative")
+	}
+
+	if c.Workers < 1 {
+		return fmt.Errorf("WORKERS must be at least 1")
+	}
+
+	if c.FaultRate < 0 || c.FaultRate > 1 {
+		return fmt.Errorf("FAULT_RATE must be between 0 and 1")
+	}
+	for _, kind := range c.FaultTypes {
+		if !contains(faultKinds, kind) {
+			return fmt.Errorf("FAULT_TYPES: unknown fault %q, expected one of %s", kind, strings.Join(faultKinds, ", "))
+		}
+	}
+	if c.FaultRate > 0 && len(c.FaultTypes) == 0 {
+		return fmt.Errorf("FAULT_TYPES must not be empty when FAULT_RATE is set")
+	}
+	if c.FaultClockSkew <= 0 {
+		return fmt.Errorf("FAULT_CLOCK_SKEW must be positive")
+	}
+	if c.FaultOversizeBytes < 1 {
+		return fmt.Errorf("FAULT_OVERSIZE_BYTES must be at least 1")
+	}
+
+	if c.PIIRate < 0 || c.PIIRate > 1 {
+		return fmt.Errorf("PII_RATE must be between 0 and 1")
+	}
+	for _, kind := range c.PIITypes {
+		if !contains(piiKinds, kind) {
+			return fmt.Errorf("PII_TYPES: unknown type %q, expected one of %s", kind, strings.Join(piiKinds, ", "))
+		}
+	}
+	if c.PIIRate > 0 && len(c.PIITypes) == 0 {
+		return fmt.Errorf("PII_TYPES must not be empty when PII_RATE is set")
+	}
+
+	if c.TrafficPeakHour < 0 || c.TrafficPeakHour >= 24 {
+		return fmt.Errorf("TRAFFIC_PEAK_HOUR must be between 0 and 24")
+	}
+	if c.TrafficAmplitude < 0 || c.TrafficAmplitude > 1 {
+		return fmt.Errorf("TRAFFIC_AMPLITUDE must be between 0 and 1")
+	}
+	if c.TrafficWeekendFactor <= 0 {
+		return fmt.Errorf("TRAFFIC_WEEKEND_FACTOR must be positive")
+	}
+	if c.TrafficNoise < 0 || c.TrafficNoise > 1 {
+		return fmt.Errorf("TRAFFIC_NOISE must be between 0 and 1")
+	}
+	if _, err := c.TrafficCurve(); err != nil {
+		return err
+	}
+
+	if err := (Distribution{c.LatencyP50, c.LatencyP99}).Validate(); err != nil {
+		return fmt.Errorf("LATENCY_P50 and LATENCY_P99: %w", err)
+	}
+	if c.HTTPErrorRate < 0 || c.HTTPClientErrorRate < 0 || c.HTTPErrorRate+c.HTTPClientErrorRate > 1 {
+		return fmt.Errorf("HTTP_ERROR_RATE and HTTP_CLIENT_ERROR_RATE must not be negative or add up to more than 1")
+	}
+	if c.BurstErrorFactor < 1 {
+		return fmt.Errorf("BURST_ERROR_FACTOR must be at least 1")
+	}
+
+	if c.SecurityRate < 0 || c.SecurityRate > 1 {
+		return fmt.Errorf("SECURITY_RATE must be between 0 and 1")
+	}
+	for _, kind := range c.SecurityTypes {
+		if !contains(securityKinds, kind) {
+			return fmt.Errorf("SECURITY_TYPES: unknown type %q, expected one of %s", kind, strings.Join(securityKinds, ", "))
+		}
+	}
+	if c.SecurityRate > 0 && len(c.SecurityTypes) == 0 {
+		return fmt.Errorf("SECURITY_TYPES must not be empty when SECURITY_RATE is set")
+	}
+
+	if c.CascadeFailureRate < 0 {
+		return fmt.Errorf("CASCADE_FAILURE_RATE must not be negative")
+	}
+	if c.CascadeFailureDuration <= 0 {
+		return fmt.Errorf("CASCADE_FAILURE_DURATION must be positive")
+	}
+	if c.CascadeLag < 0 {
+		return fmt.Errorf("CASCADE_LAG must not be negative")
+	}
+	if c.CascadeLatencyFactor < 1 {
+		return fmt.Errorf("CASCADE_LATENCY_FACTOR must be at least 1")
+	}
+
+	if c.HostCount < 0 {
+		return fmt.Errorf("HOST_COUNT must not be negative")
+	}
+	if c.HostCount > 0 && !hostPrefixPattern.MatchString(c.HostPrefix) {
+		return fmt.Errorf("HOST_PREFIX must be letters, digits, - and _")
+	}
+	if !contains(outputLayouts, c.OutputLayout) {
+		return fmt.Errorf("OUTPUT_LAYOUT: unknown layout %q, expected one of %s", c.OutputLayout, strings.Join(outputLayouts, ", "))
+	}
+	if c.OutputLayout == layoutPerService && c.HostCount == 0 {
+		return fmt.Errorf("OUTPUT_LAYOUT %s needs HOST_COUNT", layoutPerService)
+	}
+	if c.OutputLayout == layoutPerService && c.ReplayFile != "" {
+		return fmt.Errorf("REPLAY_FILE cannot be used with OUTPUT_LAYOUT %s", layoutPerService)
+	}
+
+	return nil
+}
+
+func isLogLevel(level string) bool {
+	switch level {
+	case DEBUG, INFO, WARNING, ERROR, CRITICAL:
+		return true
+	}
+	return false
+}
+
+func isLogFormat(format string) bool {
+	_, ok := LookupFormat(format)
+	return ok
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingFields lists the fields a full (PUT) update left out.
+func (u ConfigUpdate) MissingFields() []string {
+	var missing []string
+	if u.LogRate == nil {
+		missing = append(missing, "LOG_RATE")
+	}
+	if u.LogDistribution == nil {
+		missing = append(missing, "LOG_DISTRIBUTION")
+	}
+	if u.LogFormat == nil {
+		missing = append(missing, "LOG_FORMAT")
+	}
+	if u.Services == nil {
+		missing = append(missing, "SERVICES")
+	}
+	if u.EnableBursts == nil {
+		missing = append(missing, "ENABLE_BURSTS")
+	}
+	if u.BurstFrequency == nil {
+		missing = append(missing, "BURST_FREQUENCY")
+	}
+	if u.BurstMultiplier == nil {
+		missing = append(missing, "BURST_MULTIPLIER")
+	}
+	if u.BurstDuration == nil {
+		missing = append(missing, "BURST_DURATION")
+	}
+	return missing
+}
+
+// ScenarioFields lists the fields set in the update that a scenario decides
+// for itself while it is loaded.
+func (u ConfigUpdate) ScenarioFields() []string {
+	var fields []string
+	if u.LogRate != nil {
+		fields = append(fields, "LOG_RATE")
+	}
+	if u.EnableBursts != nil {
+		fields = append(fields, "ENABLE_BURSTS")
+	}
+	return fields
+}
+
+// ApplyTo returns cfg with the fields set in the update replaced.
+func (u ConfigUpdate) ApplyTo(cfg Config) Config {
+	if u.LogRate != nil {
+		cfg.LogRate = *u.LogRate
+	}
+	if u.LogDistribution != nil {
+		distribution := make(map[string]int, len(u.LogDistribution))
+		types := make([]string, 0, len(u.LogDistribution))
+		for level, weight := range u.LogDistribution {
+			level = strings.ToUpper(level)
+			distribution[level] = weight
+			types = append(types, level)
+		}
+		sort.Strings(types)
+		cfg.LogDistribution = distribution
+		cfg.LogTypes = types
+	}
+	if u.LogFormat != nil {
+		cfg.LogFormat = *u.LogFormat
+	}
+	if u.Services != nil {
+		services := make([]string, len(u.Services))
+		for i, service := range u.Services {
+			services[i] = strings.TrimSpace(service)
+		}
+		cfg.Services = services
+	}
+	if u.EnableBursts != nil {
+		cfg.EnableBursts = *u.EnableBursts
+	}
+	if u.BurstFrequency != nil {
+		cfg.BurstFrequency = *u.BurstFrequency
+	}
+	if u.BurstMultiplier != nil {
+		cfg.BurstMultiplier = *u.BurstMultiplier
+	}
+	if u.BurstDuration != nil {
+		cfg.BurstDuration = *u.BurstDuration
+	}
+	return cfg
+}
+
+// FormatWeight is one entry of a LOG_FORMAT mix.
+type FormatWeight struct {
+	Name   string
+	Weight int
+	Format Format
+}
+
+// ParseLogFormat accepts a single format ("json") or a weighted mix
+// ("json:60,apache:30,nginx:10"). Entries without a weight count as 1.
+func ParseLogFormat(value string) ([]FormatWeight, error) {
+	var mix []FormatWeight
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, weightStr, hasWeight := strings.Cut(part, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1
+		if hasWeight {
+			w, err := strconv.Atoi(strings.TrimSpace(weightStr))
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("invalid weight %q for format %s", weightStr, name)
+			}
+			weight = w
+		}
+
+		format, ok := LookupFormat(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown format %q, expected one of %s", name, strings.Join(formatNames(), ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("format %s listed more than once", name)
+		}
+		seen[name] = true
+
+		mix = append(mix, FormatWeight{Name: name, Weight: weight, Format: format})
+	}
+
+	total := 0
+	for _, f := range mix {
+		total += f.Weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("no format with a positive weight in %q", value)
+	}
+
+	return mix, nil
 }
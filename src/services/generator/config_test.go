@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseLogFormat(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string // name:weight pairs
+		wantErr string
+	}{
+		{value: "json", want: "json:1"},
+		{value: "json:3,apache", want: "json:3 apache:1"},
+		{value: " JSON : 2 , logfmt:0 ,", want: "json:2 logfmt:0"},
+		{value: "app:0,cri:5", want: "app:0 cri:5"},
+		{value: "json:-1", wantErr: "invalid weight"},
+		{value: "json:two", wantErr: "invalid weight"},
+		{value: "json:", wantErr: "invalid weight"},
+		{value: "xml", wantErr: `unknown format "xml"`},
+		{value: "json,apache,json:2", wantErr: "listed more than once"},
+		{value: "json:0,apache:0", wantErr: "no format with a positive weight"},
+		{value: "", wantErr: "no format with a positive weight"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			mix, err := ParseLogFormat(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseLogFormat(%q) error = %v, want it to contain %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, f := range mix {
+				if f.Format == nil || f.Format.Name() != f.Name {
+					t.Errorf("%s resolved to format %v", f.Name, f.Format)
+				}
+				got = append(got, f.Name+":"+strconv.Itoa(f.Weight))
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("ParseLogFormat(%q) = %s, want %s", tt.value, strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectFormatFollowsWeights(t *testing.T) {
+	lg := newTestGenerator(t, map[string]string{
+		"SEED":       "5",
+		"LOG_FORMAT": "json:3,logfmt:1,apache:0",
+	})
+
+	const draws = 8000
+	counts := map[string]int{}
+	for i := 0; i < draws; i++ {
+		counts[lg.selectFormat().Name()]++
+	}
+
+	tests := []struct {
+		format string
+		share  float64
+	}{
+		{"json", 0.75},
+		{"logfmt", 0.25},
+		{"apache", 0},
+	}
+	for _, tt := range tests {
+		got := float64(counts[tt.format]) / draws
+		if got < tt.share-0.02 || got > tt.share+0.02 {
+			t.Errorf("%s picked %.3f of the time, want %.2f", tt.format, got, tt.share)
+		}
+	}
+}
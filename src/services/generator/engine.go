@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// how long written lines may sit in the output buffer
+	flushInterval = 200 * time.Millisecond
+	outputBufSize = 256 * 1024
+
+	// how many times a second the limiter wakes a worker at most; above this
+	// rate workers take tokens in batches
+	limiterWakeups = 1000
+)
+
+// tokenBucket paces line generation. Callers reserve tokens up front and sleep
+// off any debt, so the long-run rate stays exact even when sleeps overshoot.
+type tokenBucket struct {
+	mu       sync.Mutex
+	clock    Clock
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(clock Clock, rate float64) *tokenBucket {
+	b := &tokenBucket{
+		clock:  clock,
+		tokens: 1,
+		last:   clock.Now(),
+	}
+	b.setRateLocked(rate)
+	return b
+}
+
+func (b *tokenBucket) SetRate(rate float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refillLocked()
+	b.setRateLocked(rate)
+}
+
+// Rate is the rate the bucket currently refills at.
+func (b *tokenBucket) Rate() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate
+}
+
+func (b *tokenBucket) setRateLocked(rate float64) {
+	if rate <= 0 {
+		rate = 1
+	}
+	b.rate = rate
+	// a twentieth of a second of slack lets workers catch up after oversleeping
+	b.capacity = math.Max(float64(batchSize(rate)), rate/20)
+}
+
+func (b *tokenBucket) refillLocked() {
+	now := b.clock.Now()
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// Wait reserves n tokens and blocks until they are paid for.
+func (b *tokenBucket) Wait(n int) {
+	b.mu.Lock()
+	b.refillLocked()
+	b.tokens -= float64(n)
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if wait > 0 {
+		b.clock.Sleep(wait)
+	}
+}
+
+// batchSize is how many lines a worker generates per token reservation.
+func batchSize(rate float64) int {
+	if n := int(rate / limiterWakeups); n > 1 {
+		return n
+	}
+	return 1
+}
+
+// logOutput is what the generator's logger writes to, one entry per Write.
+// Close flushes it and stops any background flushing; writing again after
+// Close is allowed.
+type logOutput interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+// bufferedOutput batches writes to the log file and console. While it is
+// being written to it is flushed every flushInterval, and Close flushes the
+// rest.
+type bufferedOutput struct {
+	mu   sync.Mutex
+	buf  *bufio.Writer
+	stop chan struct{} // non-nil while the flushing goroutine runs
+}
+
+func newBufferedOutput(w io.Writer) *bufferedOutput {
+	return &bufferedOutput{buf: bufio.NewWriterSize(w, outputBufSize)}
+}
+
+func (o *bufferedOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.stop == nil {
+		o.stop = make(chan struct{})
+		go o.flushEvery(flushInterval, o.stop)
+	}
+	return o.buf.Write(p)
+}
+
+func (o *bufferedOutput) flushEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			o.Flush()
+		}
+	}
+}
+
+func (o *bufferedOutput) Flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Flush()
+}
+
+// Close stops the periodic flushing and flushes what is left. The writer
+// underneath stays open.
+func (o *bufferedOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.stop != nil {
+		close(o.stop)
+		o.stop = nil
+	}
+	return o.buf.Flush()
+}
+
+// lockedSource lets every worker share one seeded source. With a single
+// worker the sequence of values is the same as an unlocked source's.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+func newLockedSource(seed int64) *lockedSource {
+	return &lockedSource{src: rand.NewSource(seed).(rand.Source64)}
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// the seconds rateMeter averages over
+const rateWindow = 5
+
+// rateMeter counts lines per second of clock time over the last rateWindow
+// whole seconds.
+type rateMeter struct {
+	mu      sync.Mutex
+	clock   Clock
+	counts  [rateWindow + 1]int64
+	seconds [rateWindow + 1]int64
+}
+
+func newRateMeter(clock Clock) *rateMeter {
+	return &rateMeter{clock: clock}
+}
+
+func (m *rateMeter) Add(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sec := m.clock.Now().Unix()
+	idx := sec % int64(len(m.counts))
+	if m.seconds[idx] != sec {
+		m.seconds[idx], m.counts[idx] = sec, 0
+	}
+	m.counts[idx] += int64(n)
+}
+
+// Rate is the average lines per second over the last whole seconds; the
+// current second is still filling up, so it is left out.
+func (m *rateMeter) Rate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now().Unix()
+	var total int64
+	for i, sec := range m.seconds {
+		if sec < now && sec >= now-rateWindow {
+			total += m.counts[i]
+		}
+	}
+	return float64(total) / rateWindow
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+)
+
+var engineTestStart = time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+
+func TestTokenBucketRefill(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"nothing elapsed", 100, 0, 1},
+		{"partial refill", 100, 20 * time.Millisecond, 3},
+		{"capped at a twentieth of a second", 100, time.Second, 5},
+		{"capped at one token at low rates", 10, time.Second, 1},
+		{"capped at high rates", 40000, time.Second, 2000},
+		{"zero rate refills at one a second", 0, 500 * time.Millisecond, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock(engineTestStart)
+			b := newTokenBucket(clock, tt.rate)
+			clock.Sleep(tt.elapsed)
+
+			b.mu.Lock()
+			b.refillLocked()
+			got := b.tokens
+			b.mu.Unlock()
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("tokens = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenBucketWaitKeepsRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		batch int
+		waits int
+	}{
+		{"one at a time", 100, 1, 101},
+		{"slow", 2, 1, 11},
+		{"in batches", 50000, 50, 1001},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock(engineTestStart)
+			b := newTokenBucket(clock, tt.rate)
+			for i := 0; i < tt.waits; i++ {
+				b.Wait(tt.batch)
+			}
+
+			// the first token is free, every other one is slept for
+			want := time.Duration(float64(tt.waits*tt.batch-1) / tt.rate * float64(time.Second))
+			if got := clock.Now().Sub(engineTestStart); got < want-time.Millisecond || got > want+time.Millisecond {
+				t.Errorf("%d lines took %v, want %v", tt.waits*tt.batch, got, want)
+			}
+		})
+	}
+}
+
+func TestTokenBucketSetRate(t *testing.T) {
+	clock := newFakeClock(engineTestStart)
+	b := newTokenBucket(clock, 10)
+	b.Wait(1)
+
+	b.SetRate(1000)
+	b.Wait(100)
+	if got, want := clock.Now().Sub(engineTestStart), 100*time.Millisecond; got != want {
+		t.Errorf("100 lines at 1000/s took %v, want %v", got, want)
+	}
+
+	b.SetRate(-5)
+	if got := b.Rate(); got != 1 {
+		t.Errorf("Rate() after SetRate(-5) = %v, want 1", got)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	tests := []struct {
+		rate float64
+		want int
+	}{
+		{0, 1},
+		{10, 1},
+		{1999, 1},
+		{2000, 2},
+		{50000, 50},
+		{123456, 123},
+	}
+	for _, tt := range tests {
+		if got := batchSize(tt.rate); got != tt.want {
+			t.Errorf("batchSize(%v) = %d, want %d", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestRateMeter(t *testing.T) {
+	clock := newFakeClock(engineTestStart)
+	m := newRateMeter(clock)
+
+	steps := []struct {
+		name string
+		add  int
+		want float64 // Rate() once the second is over
+	}{
+		{"first second", 100, 20},
+		{"second second", 200, 60},
+		{"quiet second", 0, 60},
+		{"fourth second", 50, 70},
+		{"fifth second", 150, 100},
+		{"first second leaves the window", 500, 180},
+	}
+	var before float64
+	for _, step := range steps {
+		m.Add(step.add)
+		if got := m.Rate(); got != before {
+			t.Errorf("%s: Rate() = %v while the second fills up, want %v", step.name, got, before)
+		}
+		before = step.want
+		clock.Sleep(time.Second)
+		if got := m.Rate(); got != step.want {
+			t.Errorf("%s: Rate() = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestLockedSourceMatchesUnlocked(t *testing.T) {
+	locked := rand.New(newLockedSource(42))
+	plain := rand.New(rand.NewSource(42))
+	for i := 0; i < 1000; i++ {
+		if a, b := locked.Int63(), plain.Int63(); a != b {
+			t.Fatalf("value %d: locked %d, unlocked %d", i, a, b)
+		}
+	}
+}
+
+// readJSONLines decodes every line of path as a log entry.
+func readJSONLines(t *testing.T, path string) []LogEntry {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var entries []LogEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("line %d is not a whole entry: %v\n%s", len(entries)+1, err, scanner.Text())
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestSimulatedRunWritesInOrder(t *testing.T) {
+	lg := newTestGenerator(t, map[string]string{
+		"SEED":             "3",
+		"FAKE_CLOCK_START": "2026-09-01T10:00:00Z",
+		"LOG_RATE":         "100",
+		"LOG_FORMAT":       "json",
+		"ENABLE_BURSTS":    "false",
+		// a simulated clock runs a single worker whatever is asked for
+		"WORKERS": "4",
+	})
+	lg.Run(10, nil)
+	lg.output.Close()
+
+	entries := readJSONLines(t, lg.Config().OutputFile)
+	if len(entries) < 1000 || len(entries) > 1010 {
+		t.Errorf("wrote %d lines in 10s at 100/s", len(entries))
+	}
+	var last time.Time
+	for i, entry := range entries {
+		ts, err := time.Parse(time.RFC3339, entry.Timestamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ts.Before(last) {
+			t.Fatalf("line %d at %s follows one at %s", i+1, ts, last)
+		}
+		last = ts
+	}
+}
+
+func TestWorkersWriteWholeLines(t *testing.T) {
+	lg := newTestGenerator(t, map[string]string{
+		"SEED": "3",
+		// low enough that the output stays under lumberjack's 1MB and never rotates
+		"LOG_RATE":      "2000",
+		"LOG_FORMAT":    "json",
+		"ENABLE_BURSTS": "false",
+		"WORKERS":       "8",
+	})
+	lg.Run(0.5, nil)
+	lg.output.Close()
+
+	entries := readJSONLines(t, lg.Config().OutputFile)
+	if int64(len(entries)) != lg.emitted.Load() {
+		t.Errorf("file has %d lines, %d were emitted", len(entries), lg.emitted.Load())
+	}
+	// real sleeps overshoot, but the bucket's slack lets workers catch up
+	if len(entries) < 800 || len(entries) > 1200 {
+		t.Errorf("wrote %d lines in 0.5s at 2000/s", len(entries))
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var faultKinds = []string{
+	"truncated_json",
+	"invalid_utf8",
+	"oversized",
+	"embedded_newline",
+	"clock_skew",
+	"out_of_order",
+	"duplicate",
+}
+
+// byte sequences that are not valid UTF-8: a stray continuation byte, bad
+// continuations, a truncated sequence and an encoded surrogate
+var invalidUTF8Sequences = []string{"\xff", "\xc3\x28", "\xe2\x82", "\xf0\x28\x8c\xbc", "\xed\xa0\x80"}
+
+// the most lines an out_of_order line is held back behind
+const maxFaultDelay = 10
+
+// FaultRecord is one line of the fault manifest. SHA256 covers the bytes of
+// the faulted line as written, without the trailing newline, so tests can
+// find it even when the fault mangled its tag.
+type FaultRecord struct {
+	ID          string    `json:"id"`
+	Fault       string    `json:"fault"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Detail      string    `json:"detail,omitempty"`
+	Bytes       int       `json:"bytes"`
+	SHA256      string    `json:"sha256"`
+}
+
+type heldLine struct {
+	entry routedEntry
+	after int
+}
+
+// faultInjector corrupts a share of the generated lines. Every faulted line is
+// tagged with fault=<kind>:<id> (a "fault" field in JSON lines) and recorded
+// in the manifest.
+type faultInjector struct {
+	mu       sync.Mutex
+	manifest *manifestWriter
+	next     int
+	held     []heldLine
+}
+
+func newFaultInjector(path string) (*faultInjector, error) {
+	manifest, err := newManifestWriter(path)
+	if err != nil {
+		return nil, err
+	}
+	return &faultInjector{manifest: manifest}, nil
+}
+
+// release counts one more line written and returns the held lines now due.
+func (f *faultInjector) release() []routedEntry {
+	var due []routedEntry
+	kept := f.held[:0]
+	for _, h := range f.held {
+		if h.after--; h.after <= 0 {
+			due = append(due, h.entry)
+		} else {
+			kept = append(kept, h)
+		}
+	}
+	f.held = kept
+	return due
+}
+
+// drain returns every line still held back.
+func (f *faultInjector) drain() []routedEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries := make([]routedEntry, len(f.held))
+	for i, h := range f.held {
+		entries[i] = h.entry
+	}
+	f.held = nil
+	return entries
+}
+
+// injectFaults returns the entries to write in place of entry: usually just
+// entry, but a faulted entry may be held back, duplicated or rewritten. Only
+// the first line of a multi-line entry is faulted, and every entry keeps the
+// routes it was generated with.
+func (lg *LogGenerator) injectFaults(entry routedEntry) []routedEntry {
+	f := lg.faults
+	if f == nil {
+		return []routedEntry{entry}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries := []routedEntry{entry}
+	if lg.cfg.FaultRate <= 0 || lg.rng.Float64() >= lg.cfg.FaultRate {
+		return append(entries, f.release()...)
+	}
+
+	first, rest, multiline := strings.Cut(entry.text, "\n")
+	route := entry.route
+	isJSON := strings.HasPrefix(first, "{")
+	_, _, _, _, hasTimestamp := findTimestamp(first)
+
+	var kinds []string
+	for _, kind := range lg.cfg.FaultTypes {
+		if kind == "truncated_json" && !isJSON {
+			continue
+		}
+		if kind == "clock_skew" && !hasTimestamp {
+			continue
+		}
+		kinds = append(kinds, kind)
+	}
+	if len(kinds) == 0 {
+		return append(entries, f.release()...)
+	}
+	kind := kinds[lg.rng.Intn(len(kinds))]
+
+	f.next++
+	id := fmt.Sprintf("f-%06d", f.next)
+	first, bodyStart, bodyEnd := tagLine(first, kind, id, isJSON)
+
+	var detail string
+	switch kind {
+	case "truncated_json":
+		// keep the tag, lose at least the closing brace
+		cut := bodyStart + lg.rng.Intn(bodyEnd-bodyStart+1)
+		first = first[:cut]
+		detail = fmt.Sprintf("truncated to %d bytes", cut)
+	case "invalid_utf8":
+		seq := invalidUTF8Sequences[lg.rng.Intn(len(invalidUTF8Sequences))]
+		at := lg.bodyOffset(bodyStart, bodyEnd)
+		first = first[:at] + seq + first[at:]
+		detail = fmt.Sprintf("%q at byte %d", seq, at)
+	case "oversized":
+		pad := lg.cfg.FaultOversizeBytes - len(first)
+		if pad < 1 {
+			pad = 1
+		}
+		if isJSON {
+			first = first[:bodyStart] + `"padding":"` + strings.Repeat("A", pad) + `",` + first[bodyStart:]
+		} else {
+			first = first + " padding=" + strings.Repeat("A", pad)
+		}
+		detail = fmt.Sprintf("%d bytes", len(first))
+	case "embedded_newline":
+		at := lg.bodyOffset(bodyStart, bodyEnd)
+		first = first[:at] + "\n" + first[at:]
+		detail = fmt.Sprintf("newline at byte %d", at)
+		// both halves belong to the first line's route
+		route = append(entryRoute{route.line(0)}, route...)
+	case "clock_skew":
+		skew := time.Duration((lg.rng.Float64()*2 - 1) * lg.cfg.FaultClockSkew * float64(time.Second)).Truncate(time.Second)
+		if skew == 0 {
+			skew = time.Second
+		}
+		// only lines with a timestamp get here, and the tag leaves it in place
+		ts, start, end, layout, _ := findTimestamp(first)
+		first = first[:start] + ts.Add(skew).Format(layout) + first[end:]
+		detail = "skewed by " + skew.String()
+	}
+
+	if multiline {
+		first += "\n" + rest
+	}
+
+	sum := sha256.Sum256([]byte(first))
+	rec := FaultRecord{
+		ID:          id,
+		Fault:       kind,
+		GeneratedAt: lg.clock.Now(),
+		Detail:      detail,
+		Bytes:       len(first),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+
+	faulted := routedEntry{text: first, route: route}
+	switch kind {
+	case "out_of_order":
+		after := lg.rng.Intn(maxFaultDelay) + 1
+		rec.Detail = "written after " + strconv.Itoa(after) + " later lines"
+		entries = f.release()
+		f.held = append(f.held, heldLine{entry: faulted, after: after})
+	case "duplicate":
+		rec.Detail = "written twice"
+		entries = append([]routedEntry{faulted, faulted}, f.release()...)
+	default:
+		entries = append([]routedEntry{faulted}, f.release()...)
+	}
+
+	f.manifest.Write(rec)
+	return entries
+}
+
+// tagLine marks line with its fault and returns the byte range of the line
+// after the tag that a fault may cut into.
+func tagLine(line, kind, id string, isJSON bool) (tagged string, bodyStart, bodyEnd int) {
+	if isJSON {
+		prefix := `{"fault":"` + kind + ":" + id + `",`
+		tagged = prefix + line[1:]
+		return tagged, len(prefix), len(tagged) - 1
+	}
+
+	tagged = line + " fault=" + kind + ":" + id
+	return tagged, 0, len(line)
+}
+
+// bodyOffset picks a byte in the second half of the body, so the start of the
+// line still looks like its format.
+func (lg *LogGenerator) bodyOffset(start, end int) int {
+	mid := start + (end-start)/2
+	if end <= mid {
+		return mid
+	}
+	return mid + lg.rng.Intn(end-mid)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFaultTestGenerator(t *testing.T, types ...string) (*LogGenerator, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "faults.jsonl")
+	faults, err := newFaultInjector(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg := &LogGenerator{
+		cfg:    Config{FaultRate: 1, FaultTypes: types, FaultClockSkew: 300, FaultOversizeBytes: 100},
+		rng:    rand.New(newLockedSource(1)),
+		clock:  newFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)),
+		faults: faults,
+	}
+	return lg, path
+}
+
+func readFaultRecords(t *testing.T, lg *LogGenerator, path string) []FaultRecord {
+	t.Helper()
+	if err := lg.faults.manifest.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []FaultRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec FaultRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestClockSkewSkipsLinesWithoutTimestamp(t *testing.T) {
+	lg, path := newFaultTestGenerator(t, "clock_skew", "duplicate")
+
+	line := "no timestamp here"
+	for i := 0; i < 50; i++ {
+		for _, e := range lg.injectFaults(routedEntry{text: line}) {
+			if strings.Contains(e.text, "clock_skew") {
+				t.Fatalf("line without a timestamp was skewed: %q", e.text)
+			}
+		}
+	}
+
+	for _, rec := range readFaultRecords(t, lg, path) {
+		if rec.Fault != "duplicate" {
+			t.Errorf("fault %s recorded for a line without a timestamp", rec.Fault)
+		}
+	}
+}
+
+func TestClockSkewShiftsTimestamp(t *testing.T) {
+	lg, path := newFaultTestGenerator(t, "clock_skew")
+
+	line := `{"timestamp":"2026-01-01T00:00:00Z","log_type":"INFO","message":"ok"}`
+	entries := lg.injectFaults(routedEntry{text: line})
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+
+	ts, _, _, _, ok := findTimestamp(entries[0].text)
+	if !ok {
+		t.Fatalf("faulted line lost its timestamp: %q", entries[0].text)
+	}
+	records := readFaultRecords(t, lg, path)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	skew, err := time.ParseDuration(strings.TrimPrefix(records[0].Detail, "skewed by "))
+	if err != nil {
+		t.Fatalf("unexpected detail %q", records[0].Detail)
+	}
+	if want := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Add(skew); !ts.Equal(want) {
+		t.Errorf("timestamp %s, want %s", ts, want)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	layoutShared     = "shared"
+	layoutPerService = "per_service"
+)
+
+var outputLayouts = []string{layoutShared, layoutPerService}
+
+var hostPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// names that are safe to use as a file name under OUTPUT_DIR
+var routedNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// files in the per_service layout for lines that no service writes
+const (
+	accessFile   = "access"
+	nginxFile    = "nginx"
+	unroutedFile = "other"
+)
+
+// hostNames names the virtual hosts <prefix>-01 to <prefix>-<n>.
+func hostNames(prefix string, n int) []string {
+	width := len(strconv.Itoa(n))
+	if width < 2 {
+		width = 2
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%0*d", prefix, width, i+1)
+	}
+	return names
+}
+
+// defaultManifest is where a manifest goes when its file is not set: next to
+// OUTPUT_FILE, or at the top of OUTPUT_DIR in the per_service layout.
+func (c Config) defaultManifest(kind string) string {
+	if c.OutputLayout == layoutPerService {
+		return filepath.Join(c.OutputDir, kind+".jsonl")
+	}
+	return c.OutputFile + "." + kind + ".jsonl"
+}
+
+// fleetHost picks the virtual host a line comes from, or "" when HOST_COUNT
+// is not set.
+func (lg *LogGenerator) fleetHost() string {
+	if len(lg.hosts) == 0 {
+		return ""
+	}
+	return lg.hosts[lg.rng.Intn(len(lg.hosts))]
+}
+
+// eventHost is the host a service event names: a virtual host, or one of the
+// sample hostnames without a fleet.
+func (lg *LogGenerator) eventHost() string {
+	if host := lg.fleetHost(); host != "" {
+		return host
+	}
+	return sampleData["host"][lg.rng.Intn(len(sampleData["host"]))]
+}
+
+// lineRoute is the host and service a line was generated for, which pick its
+// file in the per_service layout.
+type lineRoute struct {
+	Host    string
+	Service string
+}
+
+// entryRoute holds a route per line of an entry, added as the lines are
+// generated. Lines past the last route, such as stack trace frames, follow the
+// line before them.
+type entryRoute []lineRoute
+
+// add records the next line's route. A nil route records nothing.
+func (r *entryRoute) add(host, service string) {
+	if r != nil {
+		*r = append(*r, lineRoute{Host: host, Service: service})
+	}
+}
+
+// line returns the route of the i-th line.
+func (r entryRoute) line(i int) lineRoute {
+	if len(r) == 0 {
+		return lineRoute{}
+	}
+	return r[min(i, len(r)-1)]
+}
+
+// routedEntry is an entry to write along with the routes of its lines.
+type routedEntry struct {
+	text  string
+	route entryRoute
+}
+
+// writeEntry writes one entry, filing its lines by their routes in the
+// per_service layout. Write errors are dropped, as the logger drops them.
+func (lg *LogGenerator) writeEntry(e routedEntry) {
+	if out, ok := lg.output.(*routedOutput); ok {
+		out.WriteEntry(e)
+		return
+	}
+	lg.logger.Println(e.text)
+}
+
+// routedOutput writes every line to <dir>/<host>/<service>.log, by the route
+// it was generated with.
+type routedOutput struct {
+	mu      sync.Mutex
+	dir     string
+	hosts   []string
+	console *bufferedOutput
+	files   map[string]routedFile
+}
+
+type routedFile struct {
+	out     *bufferedOutput
+	logfile *lumberjack.Logger
+}
+
+func newRoutedOutput(dir string, hosts []string, console *bufferedOutput) *routedOutput {
+	return &routedOutput{
+		dir:     dir,
+		hosts:   hosts,
+		console: console,
+		files:   make(map[string]routedFile),
+	}
+}
+
+// Write takes lines that come without a route, which go to other.log on the
+// first host.
+func (o *routedOutput) Write(p []byte) (int, error) {
+	if err := o.WriteEntry(routedEntry{text: strings.TrimSuffix(string(p), "\n")}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteEntry writes each line of e to the file of its route.
+func (o *routedOutput) WriteEntry(e routedEntry) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.console != nil {
+		if _, err := o.console.Write([]byte(e.text + "\n")); err != nil {
+			return err
+		}
+	}
+
+	for i, line := range strings.Split(e.text, "\n") {
+		out, err := o.file(o.path(e.route.line(i)))
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write([]byte(line + "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *routedOutput) path(r lineRoute) string {
+	name := r.Service
+	if !routedNamePattern.MatchString(name) {
+		name = unroutedFile
+	}
+	host := r.Host
+	if !contains(o.hosts, host) {
+		host = o.hosts[0]
+	}
+	return filepath.Join(o.dir, host, name+".log")
+}
+
+// file returns the output for path, opening it on first use.
+func (o *routedOutput) file(path string) (*bufferedOutput, error) {
+	if f, ok := o.files[path]; ok {
+		return f.out, nil
+	}
+	logfile, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := routedFile{out: newBufferedOutput(logfile), logfile: logfile}
+	o.files[path] = f
+	return f.out, nil
+}
+
+func (o *routedOutput) Flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var first error
+	if o.console != nil {
+		first = o.console.Flush()
+	}
+	for _, f := range o.files {
+		if err := f.out.Flush(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close flushes and closes every file. Lines written afterwards open them
+// again.
+func (o *routedOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var first error
+	if o.console != nil {
+		first = o.console.Close()
+	}
+	for path, f := range o.files {
+		if err := f.out.Close(); err != nil && first == nil {
+			first = err
+		}
+		if err := f.logfile.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(o.files, path)
+	}
+	return first
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslog facility local0, see RFC 5424 section 6.2.1
+const syslogFacility = 16
+
+// container runtimes always write nine fractional digits
+const containerTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// the private enterprise number used for our RFC 5424 structured data
+const syslogEnterpriseID = 32473
+
+var syslogSeverity = map[string]int{
+	CRITICAL: 2,
+	ERROR:    3,
+	WARNING:  4,
+	INFO:     6,
+	DEBUG:    7,
+}
+
+// LogEvent holds the fields shared by the service-level formats below, and is
+// what FormatContext.Event gives registered formats.
+type LogEvent struct {
+	Time      time.Time
+	Level     string
+	Service   string
+	Host      string
+	PID       int
+	UserID    string
+	SessionID string
+	RequestID string
+	Duration  int
+	Message   string
+}
+
+// newEvent draws the next event and records its route.
+func (lg *LogGenerator) newEvent(route *entryRoute) LogEvent {
+	serviceName := lg.cfg.Services[lg.rng.Intn(len(lg.cfg.Services))]
+	logType := lg.selectLogType(serviceName)
+	now := lg.clock.Now()
+
+	session, logType, message := lg.nextSessionEvent(logType, serviceName)
+	message, _ = lg.piiMessage(message, false)
+
+	event := LogEvent{
+		Time:      now,
+		Level:     logType,
+		Service:   serviceName,
+		Host:      lg.eventHost(),
+		PID:       lg.rng.Intn(30000) + 1000,
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+		RequestID: fmt.Sprintf("req-%d-%d", now.Unix(), lg.rng.Intn(9000)+1000),
+		Duration:  lg.cascadeLatency(serviceName, lg.serviceLatency(serviceName)),
+		Message:   message,
+	}
+	lg.stats.Record(event.Time, event.Level, event.Service, event.Duration)
+	route.add(event.Host, event.Service)
+
+	return event
+}
+
+// <134>Oct 17 14:03:05 web-01 user-service[4242]: User logged in successfully
+func (lg *LogGenerator) generateSyslog3164Log(route *entryRoute) string {
+	event := lg.newEvent(route)
+	pri := syslogFacility*8 + syslogSeverity[event.Level]
+
+	return fmt.Sprintf("<%d>%s %s %s[%d]: %s",
+		pri, event.Time.Format(time.Stamp), event.Host, event.Service, event.PID, event.Message)
+}
+
+// <134>1 2025-10-17T14:03:05.123Z web-01 user-service 4242 INFO [meta@32473 userId="user-1234" sessionId="sess-1f2e3d4c5b6a7988" requestId="req-1-1234" duration="42"] User logged in successfully
+func (lg *LogGenerator) generateSyslog5424Log(route *entryRoute) string {
+	event := lg.newEvent(route)
+	pri := syslogFacility*8 + syslogSeverity[event.Level]
+
+	structuredData := fmt.Sprintf(`[meta@%d userId="%s" sessionId="%s" requestId="%s" duration="%d"]`,
+		syslogEnterpriseID, escapeSDParam(event.UserID), escapeSDParam(event.SessionID), escapeSDParam(event.RequestID), event.Duration)
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		pri, event.Time.Format("2006-01-02T15:04:05.000Z07:00"), event.Host, event.Service,
+		event.PID, event.Level, structuredData, event.Message)
+}
+
+// time=2025-10-17T14:03:05Z level=info service=user-service user_id=user-1234 session_id=sess-1f2e3d4c5b6a7988 request_id=req-1-1234 duration=42 msg="User logged in successfully"
+func (lg *LogGenerator) generateLogfmtLog(route *entryRoute) string {
+	event := lg.newEvent(route)
+
+	pairs := [][2]string{
+		{"time", event.Time.Format(time.RFC3339)},
+		{"level", strings.ToLower(event.Level)},
+		{"service", event.Service},
+		{"host", event.Host},
+		{"user_id", event.UserID},
+		{"session_id", event.SessionID},
+		{"request_id", event.RequestID},
+		{"duration", strconv.Itoa(event.Duration)},
+		{"msg", event.Message},
+	}
+
+	parts := make([]string, len(pairs))
+	for i, pair := range pairs {
+		parts[i] = pair[0] + "=" + logfmtValue(pair[1])
+	}
+	return strings.Join(parts, " ")
+}
+
+// DockerLogEntry is a line of Docker's json-file logging driver.
+type DockerLogEntry struct {
+	Log    string `json:"log"`
+	Stream string `json:"stream"`
+	Time   string `json:"time"`
+}
+
+// {"log":"[2025-10-17T14:03:05Z] INFO [user-service] User logged in successfully\n","stream":"stdout","time":"2025-10-17T14:03:05.123456789Z"}
+func (lg *LogGenerator) generateDockerLog(route *entryRoute) string {
+	event := lg.newEvent(route)
+
+	entry := DockerLogEntry{
+		Log:    event.appLine() + "\n",
+		Stream: event.stream(),
+		Time:   event.Time.UTC().Format(containerTimeFormat),
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		panic("unable to marshal docker log entry")
+	}
+	return string(data)
+}
+
+// 2025-10-17T14:03:05.123456789Z stdout F [2025-10-17T14:03:05Z] INFO [user-service] User logged in successfully
+func (lg *LogGenerator) generateCRILog(route *entryRoute) string {
+	event := lg.newEvent(route)
+
+	return fmt.Sprintf("%s %s F %s",
+		event.Time.UTC().Format(containerTimeFormat), event.stream(), event.appLine())
+}
+
+// appLine renders the event the way generateAppLog does, which is what the
+// container runtimes wrap.
+func (e LogEvent) appLine() string {
+	return fmt.Sprintf("[%s] %s [%s] %s",
+		e.Time.Format(time.RFC3339), e.Level, e.Service, e.Message)
+}
+
+func (e LogEvent) stream() string {
+	if e.Level == ERROR || e.Level == CRITICAL {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\t") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// escapeSDParam escapes the characters RFC 5424 reserves in PARAM-VALUE.
+func escapeSDParam(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
@@ -6,19 +6,58 @@ import (
 	"io"
 	"log"
 	"math/rand"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 type LogGenerator struct {
+	mu           sync.RWMutex
 	cfg          Config
 	logger       *log.Logger
+	output       logOutput
+	limiter      *tokenBucket
+	meter        *rateMeter
+	emitted      atomic.Int64
+	control      runControl
+	rng          *rand.Rand
+	clock        Clock
+	hosts        []string
+	formats      []FormatWeight
+	callGraph    CallGraph
+	sessionMu    sync.Mutex
 	userSessions map[string]UserSession
+	activeUsers  []string
+	journey      *JourneyModel
+	templates    *MessageTemplates
+	profile      *HTTPProfile
+	stats        *StatsCollector
 	InBurstMode  bool
 	BurstEndTime time.Time
+
+	faults   *faultInjector
+	pii      *manifestWriter
+	security *securitySimulator
+
+	failures       []*ServiceFailure
+	failureHistory []*ServiceFailure
+	failureCount   int
+	failureCheckAt time.Time
+
+	traffic        TrafficCurve
+	trafficNoise   float64
+	trafficNoiseAt time.Time
+
+	scenario      *Scenario
+	scenarioPhase *ScenarioPhase
+	replay        *ReplaySource
 }
 
 var sampleData = map[string][]string{
@@ -27,6 +66,7 @@ var sampleData = map[string][]string{
 	"process":  {"worker1", "worker2", "worker3", "main", "background", "scheduler"},
 	"method":   {"GET", "POST", "PUT", "DELETE", "PATCH"},
 	"protocol": {"HTTP/1.1", "HTTP/2.0"},
+	"host":     {"web-01", "web-02", "api-01", "api-02", "worker-01"},
 	"useragent": {
 		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
 		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36",
@@ -35,64 +75,283 @@ var sampleData = map[string][]string{
 	},
 }
 
-var statusCodes = []int{200, 200, 200, 201, 204, 301, 304, 400, 401, 403, 404, 500, 502, 503}
-var responseSizes = []int{100, 250, 500, 1024, 2048, 4096, 8192, 10240, 15360, 20480}
+// openLogFile opens a rotated log file, creating its directory.
+func openLogFile(path string) (*lumberjack.Logger, error) {
+	dir := filepath.Dir(path)
 
-func NewLogGenerator(cfg Config) *LogGenerator {
-	var writers []io.Writer
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, fmt.Errorf("failed to create log dir %s: %w", dir, err)
+	}
 
-	if cfg.OutputFile != "" {
-		dir := filepath.Dir(cfg.OutputFile)
+	if err := os.Chmod(dir, 0777); err != nil {
+		log.Printf("warning: failed to chmod log dir: %v", err)
+	}
 
-		if err := os.MkdirAll(dir, 0777); err != nil {
-			log.Fatalf("failed to create log dir %s: %v", dir, err)
-		}
+	if _, err := os.Stat(path); err == nil {
+		_ = os.Chmod(path, 0777)
+	}
 
-		if err := os.Chmod(dir, 0777); err != nil {
-			log.Printf("warning: failed to chmod log dir: %v", err)
+	// lumberjack only opens the file on the first write, which would hide
+	// a path that cannot be written
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file %s: %w", path, err)
+	}
+	file.Close()
+
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    1,
+		MaxBackups: 3,
+		MaxAge:     28,
+		Compress:   true,
+	}, nil
+}
+
+// NewLogGenerator sets up a generator for cfg. It fails when a file it reads
+// is invalid or an output or manifest cannot be opened.
+func NewLogGenerator(cfg Config) (*LogGenerator, error) {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	var clock Clock = realClock{}
+	if cfg.FakeClockStart != "" {
+		start, err := time.Parse(time.RFC3339, cfg.FakeClockStart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FAKE_CLOCK_START %q: %w", cfg.FakeClockStart, err)
 		}
+		clock = newFakeClock(start)
+	}
+
+	formats, err := ParseLogFormat(cfg.LogFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q: %w", cfg.LogFormat, err)
+	}
 
-		if _, err := os.Stat(cfg.OutputFile); err == nil {
-			_ = os.Chmod(cfg.OutputFile, 0777)
+	callGraph, err := ParseCallGraph(cfg.TraceCallGraph)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRACE_CALL_GRAPH %q: %w", cfg.TraceCallGraph, err)
+	}
+
+	traffic, err := cfg.TrafficCurve()
+	if err != nil {
+		return nil, fmt.Errorf("invalid traffic curve: %w", err)
+	}
+
+	journey := &defaultJourneyModel
+	if cfg.JourneyModelFile != "" {
+		journey, err = LoadJourneyModel(cfg.JourneyModelFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load journey model: %w", err)
 		}
+	}
 
-		logfile := &lumberjack.Logger{
-			Filename:   cfg.OutputFile,
-			MaxSize:    1,
-			MaxBackups: 3,
-			MaxAge:     28,
-			Compress:   true,
+	profile := &defaultHTTPProfile
+	if cfg.HTTPProfileFile != "" {
+		profile, err = LoadHTTPProfile(cfg.HTTPProfileFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load HTTP profile: %w", err)
 		}
+	}
+
+	var writers []io.Writer
 
+	// the per_service layout writes under OUTPUT_DIR instead
+	if cfg.OutputFile != "" && cfg.OutputLayout != layoutPerService {
+		logfile, err := openLogFile(cfg.OutputFile)
+		if err != nil {
+			return nil, err
+		}
 		writers = append(writers, logfile)
 	}
 
-	if cfg.ConsoleOutput {
+	if cfg.OutputLayout == layoutPerService {
+		if err := os.MkdirAll(cfg.OutputDir, 0777); err != nil {
+			return nil, fmt.Errorf("failed to create OUTPUT_DIR %s: %w", cfg.OutputDir, err)
+		}
+	}
+
+	if cfg.ConsoleOutput && cfg.OutputLayout != layoutPerService {
 		writers = append(writers, os.Stdout)
 	}
 
-	multi := io.MultiWriter(writers...)
-	return &LogGenerator{
+	// the manifests opened so far, closed again if a later step fails
+	var manifests []*manifestWriter
+	fail := func(err error) (*LogGenerator, error) {
+		for _, m := range manifests {
+			m.Close()
+		}
+		return nil, err
+	}
+
+	var faults *faultInjector
+	if cfg.FaultRate > 0 {
+		manifest := cfg.FaultManifestFile
+		if manifest == "" {
+			manifest = cfg.defaultManifest("faults")
+		}
+		if faults, err = newFaultInjector(manifest); err != nil {
+			return fail(err)
+		}
+		manifests = append(manifests, faults.manifest)
+	}
+
+	var pii *manifestWriter
+	if cfg.PIIRate > 0 {
+		manifest := cfg.PIIManifestFile
+		if manifest == "" {
+			manifest = cfg.defaultManifest("pii")
+		}
+		if pii, err = newManifestWriter(manifest); err != nil {
+			return fail(err)
+		}
+		manifests = append(manifests, pii)
+	}
+
+	var security *securitySimulator
+	if cfg.SecurityRate > 0 {
+		manifest := cfg.SecurityManifestFile
+		if manifest == "" {
+			manifest = cfg.defaultManifest("security")
+		}
+		if security, err = newSecuritySimulator(manifest); err != nil {
+			return fail(err)
+		}
+		manifests = append(manifests, security.manifest)
+	}
+
+	rng := rand.New(newLockedSource(seed))
+	hosts := hostNames(cfg.HostPrefix, cfg.HostCount)
+
+	var output logOutput
+	if cfg.OutputLayout == layoutPerService {
+		var console *bufferedOutput
+		if cfg.ConsoleOutput {
+			console = newBufferedOutput(os.Stdout)
+		}
+		output = newRoutedOutput(cfg.OutputDir, hosts, console)
+	} else {
+		output = newBufferedOutput(io.MultiWriter(writers...))
+	}
+
+	lg := &LogGenerator{
 		cfg:          cfg,
-		logger:       log.New(multi, "", 0),
+		logger:       log.New(output, "", 0),
+		output:       output,
+		rng:          rng,
+		hosts:        hosts,
+		clock:        clock,
+		formats:      formats,
+		callGraph:    callGraph,
 		userSessions: make(map[string]UserSession),
+		journey:      journey,
+		profile:      profile,
+		stats:        NewStatsCollector(clock, cfg),
+		faults:       faults,
+		pii:          pii,
+		security:     security,
+		traffic:      traffic,
+		limiter:      newTokenBucket(clock, float64(cfg.LogRate)),
+		meter:        newRateMeter(clock),
 		InBurstMode:  false,
-		BurstEndTime: time.Now(),
+		BurstEndTime: clock.Now(),
+	}
+
+	if cfg.MessageTemplatesFile != "" {
+		templates, err := lg.LoadMessageTemplates(cfg.MessageTemplatesFile)
+		if err != nil {
+			return fail(fmt.Errorf("failed to load message templates: %w", err))
+		}
+		lg.templates = templates
 	}
+
+	return lg, nil
+}
+
+// Config returns a copy of the configuration the generator is currently using.
+func (lg *LogGenerator) Config() Config {
+	lg.mu.RLock()
+	defer lg.mu.RUnlock()
+	return lg.cfg
+}
+
+// UpdateConfig swaps in a new configuration; Run picks it up on its next line.
+// The output settings and the fleet of hosts are fixed when the generator is
+// created.
+func (lg *LogGenerator) UpdateConfig(cfg Config) error {
+	formats, err := ParseLogFormat(cfg.LogFormat)
+	if err != nil {
+		return err
+	}
+	callGraph, err := ParseCallGraph(cfg.TraceCallGraph)
+	if err != nil {
+		return err
+	}
+	traffic, err := cfg.TrafficCurve()
+	if err != nil {
+		return err
+	}
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	cfg.OutputFile = lg.cfg.OutputFile
+	cfg.ConsoleOutput = lg.cfg.ConsoleOutput
+	cfg.OutputLayout = lg.cfg.OutputLayout
+	cfg.OutputDir = lg.cfg.OutputDir
+	cfg.HostCount = lg.cfg.HostCount
+	cfg.HostPrefix = lg.cfg.HostPrefix
+	lg.cfg = cfg
+	lg.formats = formats
+	lg.callGraph = callGraph
+	lg.traffic = traffic
+	return nil
+}
+
+// Statistics returns the aggregates of the lines emitted during the last window.
+func (lg *LogGenerator) Statistics(window time.Duration) Statistics {
+	return lg.stats.Snapshot(window)
 }
 
-func (lg *LogGenerator) selectLogType() string {
+// SetScenario makes Run play back the given scenario instead of the steady
+// LOG_RATE. It must be called before Run.
+func (lg *LogGenerator) SetScenario(scenario *Scenario) {
+	lg.scenario = scenario
+}
+
+func (lg *LogGenerator) distributionFor(service string) map[string]int {
+	if lg.scenarioPhase != nil {
+		if dist := lg.scenarioPhase.DistributionFor(service); dist != nil {
+			return dist
+		}
+	}
+	return lg.cfg.LogDistribution
+}
+
+func (lg *LogGenerator) selectLogType(service string) string {
 	types := []string{}
 	weights := []int{}
 	total := 0
 
-	for t, w := range lg.cfg.LogDistribution {
+	// walk the levels in a fixed order so seeded runs pick the same ones
+	distribution := lg.distributionFor(service)
+	for t := range distribution {
 		types = append(types, t)
-		weights = append(weights, w)
-		total += w
 	}
+	sort.Strings(types)
 
-	r := rand.Intn(total)
+	for _, t := range types {
+		weights = append(weights, distribution[t])
+		total += distribution[t]
+	}
+
+	if total <= 0 {
+		return INFO
+	}
+
+	r := lg.rng.Intn(total)
 	for i, w := range weights {
 		if r < w {
 			return types[i]
@@ -102,25 +361,61 @@ func (lg *LogGenerator) selectLogType() string {
 	return "INFO"
 }
 
-func (lg *LogGenerator) generateApacheLog() string {
-	ip := sampleData["ip"][rand.Intn(len(sampleData["ip"]))]
-	timestamp := time.Now().Format("02/Jan/2006:15:04:05 -0700")
-	method := sampleData["method"][rand.Intn(len(sampleData["method"]))]
-	endpoint := sampleData["endpoint"][rand.Intn(len(sampleData["endpoint"]))]
-	protocol := sampleData["protocol"][rand.Intn(len(sampleData["protocol"]))]
-	status := statusCodes[rand.Intn(len(statusCodes))]
-	size := responseSizes[rand.Intn(len(responseSizes))]
-	referer := "-"
-	userAgent := sampleData["useragent"][rand.Intn(len(sampleData["useragent"]))]
+// statusLevel is the level an HTTP access line counts as in the statistics.
+func statusLevel(status int) string {
+	switch {
+	case status >= 500:
+		return ERROR
+	case status >= 400:
+		return WARNING
+	default:
+		return INFO
+	}
+}
+
+func (lg *LogGenerator) generateApacheLog(route *entryRoute) string {
+	route.add(lg.fleetHost(), accessFile)
+	if line, ok := lg.securityApacheLine(); ok {
+		return line
+	}
+
+	ip := sampleData["ip"][lg.rng.Intn(len(sampleData["ip"]))]
+	method := sampleData["method"][lg.rng.Intn(len(sampleData["method"]))]
+	endpoint := sampleData["endpoint"][lg.rng.Intn(len(sampleData["endpoint"]))]
+	protocol := sampleData["protocol"][lg.rng.Intn(len(sampleData["protocol"]))]
+	status, size, latency := lg.httpResponse(method, endpoint)
+	userAgent := sampleData["useragent"][lg.rng.Intn(len(sampleData["useragent"]))]
 
-	return fmt.Sprintf(`%s - - [%s] "%s /%s %s" %d %d "%s" "%s"`,
-		ip, timestamp, method, endpoint, protocol, status, size, referer, userAgent)
+	if item := lg.maybePII(); item != nil {
+		endpoint += "?" + piiAttributes[item.Kind] + "=" + url.QueryEscape(item.Value)
+		lg.recordPII(item, "url")
+	}
+
+	return lg.apacheLine(ip, lg.clock.Now(), method, endpoint, protocol, status, size, userAgent, latency)
 }
 
-func (lg *LogGenerator) generateNginxLog() string {
-	timestamp := time.Now().Format("2006/01/02 15:04:05")
-	level := lg.selectLogType()
-	process := sampleData["process"][rand.Intn(len(sampleData["process"]))]
+// apacheLine writes one request in the combined log format followed by the
+// response time in microseconds (%D). path has no leading slash, and a size of
+// 0 is written as "-" like %b does.
+func (lg *LogGenerator) apacheLine(ip string, now time.Time, method, path, protocol string, status, size int, userAgent string, latency time.Duration) string {
+	lg.stats.Record(now, statusLevel(status), "", 0)
+
+	sent := "-"
+	if size > 0 {
+		sent = strconv.Itoa(size)
+	}
+	return fmt.Sprintf(`%s - - [%s] "%s /%s %s" %d %s "-" "%s" %d`,
+		ip, now.Format("02/Jan/2006:15:04:05 -0700"), method, path, protocol, status, sent, userAgent, latency.Microseconds())
+}
+
+func (lg *LogGenerator) generateNginxLog(route *entryRoute) string {
+	route.add(lg.fleetHost(), nginxFile)
+	timestamp := lg.clock.Now().Format("2006/01/02 15:04:05")
+	level := lg.selectLogType("")
+	process := sampleData["process"][lg.rng.Intn(len(sampleData["process"]))]
+
+	_, level, message := lg.nextSessionEvent(level, "")
+	message, _ = lg.piiMessage(message, false)
 
 	// Map log types to nginx-style levels
 	nginxLevel := map[string]string{
@@ -131,59 +426,105 @@ func (lg *LogGenerator) generateNginxLog() string {
 		"CRITICAL": "crit",
 	}[level]
 
-	userID := fmt.Sprintf("user-%d", rand.Intn(9000)+1000)
-	lg.updateUserSession(userID)
-	message := lg.createMessageFromPattern(level, userID)
+	lg.stats.Record(lg.clock.Now(), level, "", 0)
 
-	return fmt.Sprintf("%s [%s] %s: %s",
+	line := fmt.Sprintf("%s [%s] %s: %s",
 		timestamp, nginxLevel, process, message)
+	if trace := lg.maybeStackTrace(level, process); trace != "" {
+		line += "\n" + trace
+	}
+	return line
 }
 
-func (lg *LogGenerator) generateLogMessage() string {
-	generators := []func() string{
-		lg.generateApacheLog,
-		lg.generateAppLog,
-		lg.generateNginxLog,
-		lg.generateJSONLog,
+func (lg *LogGenerator) generateLogMessage() routedEntry {
+	var route entryRoute
+	text := lg.selectFormat().Generate(FormatContext{lg: lg, route: &route})
+	if len(route) == 0 {
+		// a registered format that named no service
+		route.add(lg.fleetHost(), unroutedFile)
 	}
+	return routedEntry{text: text, route: route}
+}
 
-	index := rand.Intn(len(generators))
+func (lg *LogGenerator) selectFormat() Format {
+	total := 0
+	for _, f := range lg.formats {
+		total += f.Weight
+	}
 
-	return generators[index]()
+	r := lg.rng.Intn(total)
+	for _, f := range lg.formats {
+		if r < f.Weight {
+			return f.Format
+		}
+		r -= f.Weight
+	}
+	return lg.formats[0].Format
+}
+
+// generateJSONEntry writes the json format: usually one line, but at
+// TRACE_PROBABILITY a whole trace with a line per span.
+func (lg *LogGenerator) generateJSONEntry(route *entryRoute) string {
+	if lg.cfg.TraceProbability > 0 && lg.rng.Float64() < lg.cfg.TraceProbability {
+		return lg.generateTraceLogs(route)
+	}
+	return lg.generateJSONLog(route)
 }
 
-func (lg *LogGenerator) generateAppLog() string {
-	logType := lg.selectLogType()
-	serviceName := lg.cfg.Services[rand.Intn(len(lg.cfg.Services))]
-	userID := fmt.Sprintf("user-%d", rand.Intn(9000)+1000)
-	timestamp := time.Now().Format(time.RFC3339)
+func (lg *LogGenerator) generateAppLog(route *entryRoute) string {
+	serviceName := lg.cfg.Services[lg.rng.Intn(len(lg.cfg.Services))]
+	logType := lg.selectLogType(serviceName)
+	timestamp := lg.clock.Now().Format(time.RFC3339)
 
-	lg.updateUserSession(userID)
-	message := lg.createMessageFromPattern(logType, userID)
+	_, logType, message := lg.nextSessionEvent(logType, serviceName)
+	message, _ = lg.piiMessage(message, false)
 
-	return fmt.Sprintf("[%s] %s [%s] %s",
+	lg.stats.Record(lg.clock.Now(), logType, serviceName, 0)
+
+	line := fmt.Sprintf("[%s] %s [%s] %s",
 		timestamp, logType, serviceName, message)
+	if trace := lg.maybeStackTrace(logType, serviceName); trace != "" {
+		line += "\n" + trace
+	}
+	route.add(lg.fleetHost(), serviceName)
+	return line
 }
 
-func (lg *LogGenerator) generateJSONLog() string {
-	logType := lg.selectLogType()
-	serviceName := lg.cfg.Services[rand.Intn(len(lg.cfg.Services))]
-	userID := fmt.Sprintf("user-%d", rand.Intn(9000)+1000)
-	requestID := fmt.Sprintf("req-%d-%d", time.Now().Unix(), rand.Intn(9000)+1000)
-	duration := rand.Intn(496) + 5
-	timestamp := time.Now().Format(time.RFC3339)
+func (lg *LogGenerator) generateJSONLog(route *entryRoute) string {
+	if line, ok := lg.securityLoginLine(route); ok {
+		return line
+	}
+
+	serviceName := lg.cfg.Services[lg.rng.Intn(len(lg.cfg.Services))]
+	logType := lg.selectLogType(serviceName)
+	requestID := fmt.Sprintf("req-%d-%d", lg.clock.Now().Unix(), lg.rng.Intn(9000)+1000)
+	duration := lg.cascadeLatency(serviceName, lg.serviceLatency(serviceName))
+	timestamp := lg.clock.Now().Format(time.RFC3339)
+
+	session, logType, message := lg.nextSessionEvent(logType, serviceName)
+	message, pii := lg.piiMessage(message, true)
 
-	lg.updateUserSession(userID)
-	message := lg.createMessageFromPattern(logType, userID)
+	lg.stats.Record(lg.clock.Now(), logType, serviceName, duration)
 
+	host := lg.fleetHost()
+	route.add(host, serviceName)
 	log_entry := LogEntry{
 		Timestamp: timestamp,
 		LogType:   logType,
 		Service:   serviceName,
+		Host:      host,
 		RequestID: requestID,
-		UserID:    userID,
+		UserID:    session.UserID,
 		Duration:  duration,
 		Message:   message,
+		SessionID: session.SessionID,
+		Event:     session.State,
+
+		// JSON keeps the trace escaped inside the entry so the line stays one record
+		StackTrace: lg.maybeStackTrace(logType, serviceName),
+	}
+	if pii != nil {
+		log_entry.Attributes = map[string]string{piiAttributes[pii.Kind]: pii.Value}
 	}
 
 	data, err := json.Marshal(log_entry)
@@ -193,58 +534,183 @@ func (lg *LogGenerator) generateJSONLog() string {
 	return string(data)
 }
 
-func (lg *LogGenerator) Run(duration float64) {
-	rand.New(rand.NewSource(time.Now().UnixNano()))
+// Run generates lines until duration seconds of unpaused time have passed
+// (forever when 0), a scenario finishes or stop is closed. Use Start to run it
+// under the generator's run control.
+func (lg *LogGenerator) Run(duration float64, stop <-chan struct{}) {
+	if lg.replay != nil {
+		if err := lg.Replay(duration, stop); err != nil {
+			log.Printf("replay failed: %v", err)
+		}
+		return
+	}
+
+	cfg := lg.Config()
 
 	//running in burst mode
-	fmt.Printf("Starting log generator with rate: %d logs/second ", lg.cfg.LogRate)
-	fmt.Printf("Log format: %s", lg.cfg.LogFormat)
-	fmt.Printf("Burst mode enabled: %v", lg.cfg.EnableBursts)
+	fmt.Printf("Starting log generator with rate: %d logs/second ", cfg.LogRate)
+	fmt.Printf("Log format: %s", cfg.LogFormat)
+	fmt.Printf("Burst mode enabled: %v", cfg.EnableBursts)
+	fmt.Printf("Traffic curve enabled: %v", cfg.TrafficCurveEnabled)
+
+	// a simulated clock is advanced by whoever sleeps on it, so only one worker
+	// can keep its timeline (and a seeded run) reproducible
+	workers := cfg.Workers
+	if _, simulated := lg.clock.(*fakeClock); simulated || workers < 1 {
+		workers = 1
+	}
+
+	start := lg.clock.Now()
+	lg.limiter.SetRate(float64(cfg.LogRate))
+	lg.endBurst()
+
+	if lg.scenario != nil {
+		fmt.Printf("Playing scenario %q (%d phases)\n", lg.scenario.Name, len(lg.scenario.Phases))
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+	halt := func() { once.Do(func() { close(done) }) }
+	go func() {
+		select {
+		case <-stop:
+			halt()
+		case <-done:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lg.work(start, duration, done, halt)
+		}()
+	}
+	wg.Wait()
+	halt()
+
+	// lines held back to arrive out of order still need writing
+	if lg.faults != nil {
+		for _, entry := range lg.faults.drain() {
+			lg.writeEntry(entry)
+			lg.emitted.Add(1)
+		}
+	}
 
-	start := time.Now()
-	count := 0
+	if lg.security != nil {
+		lg.security.finish()
+	}
 
+	lg.retireFailures()
+	lg.endBurst()
+	lg.output.Close()
+	fmt.Printf("Generated %d log entries\n", lg.emitted.Load())
+}
+
+// endBurst clears burst state left over from a previous run.
+func (lg *LogGenerator) endBurst() {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	lg.InBurstMode = false
+	lg.BurstEndTime = lg.clock.Now()
+}
+
+// work generates lines until the run ends, taking tokens from the shared limiter.
+func (lg *LogGenerator) work(start time.Time, duration float64, done <-chan struct{}, halt func()) {
 	for {
-		now := time.Now()
-
-		if lg.cfg.EnableBursts {
-			if !lg.InBurstMode {
-				if rand.Float64() < lg.cfg.BurstFrequency {
-					lg.InBurstMode = true
-					lg.BurstEndTime = now.Add(time.Duration(lg.cfg.BurstDuration * float64(time.Second)))
-					// lg.logger.Printf("⚡⚡ Entering burst mode for %.2f seconds", lg.cfg.BurstDuration)
-				}
-			} else {
-				if now.After(lg.BurstEndTime) {
-					lg.InBurstMode = false
-					// lg.logger.Println("✓ Exiting burst mode")
-				}
-			}
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		if !lg.waitWhilePaused(done) {
+			return
 		}
 
-		currentRate := float64(lg.cfg.LogRate)
-		if currentRate <= 0 {
-			currentRate = 1.0
+		rate, ok := lg.tick(start)
+		if !ok || (duration > 0 && lg.activeSince(start).Seconds() >= duration) {
+			halt()
+			return
 		}
-		
-		if lg.InBurstMode {
-			currentRate = currentRate * float64(lg.cfg.BurstMultiplier)
+
+		batch := batchSize(rate)
+		lg.limiter.SetRate(rate)
+		lg.limiter.Wait(batch)
+
+		for i := 0; i < batch; i++ {
+			// the read lock keeps a config update from landing halfway through a line
+			lg.mu.RLock()
+			LogEntry := lg.generateLogMessage()
+			entries := lg.injectFaults(LogEntry)
+			lg.mu.RUnlock()
+
+			for _, entry := range entries {
+				lg.writeEntry(entry) //this is where the log is actually written
+				lg.emitted.Add(1)
+			}
+			lg.meter.Add(len(entries))
 		}
+	}
+}
+
+// tick advances the scenario and burst state and returns the rate to generate
+// at. ok is false once a scenario has played to its end.
+func (lg *LogGenerator) tick(start time.Time) (rate float64, ok bool) {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	now := lg.clock.Now()
+
+	currentRate := float64(lg.cfg.LogRate)
+	burstsEnabled := lg.cfg.EnableBursts
 
-		sleep := time.Duration(float64(time.Second) / currentRate)
-		if sleep < time.Nanosecond {
-			sleep = time.Nanosecond
+	if lg.scenario != nil {
+		phase, offset, ok := lg.scenario.PhaseAt(lg.activeSince(start))
+		if !ok {
+			if lg.scenarioPhase != nil {
+				fmt.Printf("Scenario %q finished\n", lg.scenario.Name)
+				lg.scenarioPhase = nil
+			}
+			return 0, false
+		}
+		if phase != lg.scenarioPhase {
+			fmt.Printf("Scenario phase: %s (%s)\n", phase.Name, phase.Duration)
+			lg.scenarioPhase = phase
 		}
+		currentRate = phase.RateAt(offset)
+		burstsEnabled = phase.Bursts
+	} else if lg.cfg.TrafficCurveEnabled {
+		currentRate *= lg.trafficFactor(now)
+	}
 
-		LogEntry := lg.generateLogMessage()
-		lg.logger.Println(LogEntry) //this is where the log is actually written
-		count++
+	lg.tickFailures(now)
 
-		if duration > 0 && time.Since(start).Seconds() >= duration {
-			fmt.Printf("Generated %d log entries\n", count)
-			break
+	if !burstsEnabled {
+		lg.InBurstMode = false
+	} else {
+		if !lg.InBurstMode {
+			if lg.rng.Float64() < lg.cfg.BurstFrequency {
+				lg.InBurstMode = true
+				lg.BurstEndTime = now.Add(time.Duration(lg.cfg.BurstDuration * float64(time.Second)))
+				// lg.logger.Printf("⚡⚡ Entering burst mode for %.2f seconds", lg.cfg.BurstDuration)
+			}
+		} else {
+			if now.After(lg.BurstEndTime) {
+				lg.InBurstMode = false
+				// lg.logger.Println("✓ Exiting burst mode")
+			}
 		}
+	}
+
+	if currentRate <= 0 {
+		currentRate = 1.0
+	}
 
-		time.Sleep(sleep)
+	if lg.InBurstMode {
+		currentRate = currentRate * float64(lg.cfg.BurstMultiplier)
 	}
+
+	return currentRate, true
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestGenerator builds a generator from the environment, with env applied
+// on top, writing to a temporary OUTPUT_FILE and nowhere else.
+func newTestGenerator(t *testing.T, env map[string]string) *LogGenerator {
+	t.Helper()
+	t.Setenv("OUTPUT_FILE", filepath.Join(t.TempDir(), "service.log"))
+	t.Setenv("CONSOLE_OUTPUT", "false")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	cfg := LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	lg, err := NewLogGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		lg.output.Close()
+		lg.closeManifests()
+	})
+	return lg
+}
+
+// runSeeded runs a generator to the end of RUN_DURATION and returns every file
+// it wrote, by path relative to its output directory.
+func runSeeded(t *testing.T, env map[string]string) map[string][]byte {
+	t.Helper()
+	lg := newTestGenerator(t, env)
+	lg.Run(lg.Config().RunDuration, nil)
+	lg.closeManifests()
+
+	dir := filepath.Dir(lg.Config().OutputFile)
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[rel] = data
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSeededRunsAreReproducible(t *testing.T) {
+	seeded := map[string]string{
+		"SEED":              "42",
+		"FAKE_CLOCK_START":  "2026-09-01T10:00:00Z",
+		"RUN_DURATION":      "20",
+		"LOG_RATE":          "50",
+		"LOG_FORMAT":        "json:3,apache,nginx,app,syslog3164,syslog5424,logfmt,docker,cri",
+		"TRACE_PROBABILITY": "0.1",
+		"FAULT_RATE":        "0.05",
+		// small enough that the output never rotates, as rotated files are named by the wall clock
+		"FAULT_OVERSIZE_BYTES": "2048",
+		"PII_RATE":             "0.05",
+		"SECURITY_RATE":        "0.01",
+	}
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"shared", nil},
+		{"per_service", map[string]string{"HOST_COUNT": "3", "OUTPUT_LAYOUT": layoutPerService}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := make(map[string]string)
+			for key, value := range seeded {
+				env[key] = value
+			}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+
+			first, second := runSeeded(t, env), runSeeded(t, env)
+			if len(first) == 0 {
+				t.Fatal("nothing was written")
+			}
+			if len(first) != len(second) {
+				t.Fatalf("first run wrote %d files, second %d", len(first), len(second))
+			}
+			for name, data := range first {
+				if len(data) == 0 {
+					t.Errorf("%s is empty", name)
+				}
+				if !bytes.Equal(data, second[name]) {
+					t.Errorf("%s differs between runs", name)
+				}
+			}
+		})
+	}
+}
@@ -10,6 +10,8 @@ require (
 	github.com/go-playground/validator/v10 v10.27.0
 	github.com/jeanphorn/log4go v0.0.0-20231225120528-d93eb9001e51
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
+	gopkg.in/yaml.v3 v3.0.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -6,10 +6,18 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+)
+
+// lookupEnv is where the getEnv helpers read settings from. It is only
+// replaced while configMu is held.
+var (
+	configMu  sync.Mutex
+	lookupEnv = os.LookupEnv
 )
 
 func getEnv(key, defaultValue string) string {
-	if val, ok := os.LookupEnv(key); ok {
+	if val, ok := lookupEnv(key); ok {
 		return val
 	}
 	return defaultValue
@@ -68,37 +76,25 @@ func getEnvAsFloat(key string, defaultVal float64) float64 {
 	return defaultVal
 }
 
-func tailLogs(filePath string, numLines int) ([]string, error) {
-	if numLines <= 0 {
-		return nil, nil
-	}
-
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var lines []string
-	stat, err := file.Stat()
-	if err != nil {
-		return nil, err
-	}
-
+// reverseLines calls fn for each complete line that ends before offset end,
+// newest first, along with the offset the line starts at. A partial line at
+// end is skipped. It stops early when fn returns false.
+func reverseLines(file *os.File, end int64, fn func(line string, offset int64) bool) error {
 	var (
-		size    = stat.Size()
-		chunk   = int64(1024) // read 1KB chunks from the end
-		buffer  []byte
+		pos    = end
+		chunk  = int64(64 * 1024) // read 64KB chunks from the end
+		buffer []byte
+		first  = true
 	)
 
-	for pos := size; pos > 0 && len(lines) < numLines; pos -= chunk {
+	for pos > 0 {
 		if pos < chunk {
 			chunk = pos
 		}
+		pos -= chunk
 		buf := make([]byte, chunk)
-		_, err := file.ReadAt(buf, pos-chunk)
-		if err != nil {
-			return nil, err
+		if _, err := file.ReadAt(buf, pos); err != nil {
+			return err
 		}
 
 		// prepend buffer
@@ -110,20 +106,21 @@ func tailLogs(filePath string, numLines int) ([]string, error) {
 			if idx == -1 {
 				break
 			}
-			line := append([]byte(nil), buffer[idx+1:]...)
+			line := string(buffer[idx+1:])
 			buffer = buffer[:idx]
-			if len(line) > 0 {
-				lines = append([]string{string(line)}, lines...)
-				if len(lines) == numLines {
-					return lines, nil
-				}
+			if first {
+				// whatever follows the last newline before end is unfinished
+				first = false
+				continue
+			}
+			if len(line) > 0 && !fn(line, pos+int64(idx)+1) {
+				return nil
 			}
 		}
 	}
 
-	if len(buffer) > 0 && len(lines) < numLines {
-		lines = append([]string{string(buffer)}, lines...)
+	if len(buffer) > 0 && !first {
+		fn(string(buffer), 0)
 	}
-
-	return lines, nil
+	return nil
 }
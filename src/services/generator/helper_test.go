@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, data string) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lines.log")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+func TestReverseLines(t *testing.T) {
+	long := strings.Repeat("x", 70*1024)
+
+	type visit struct {
+		line   string
+		offset int64
+	}
+	tests := []struct {
+		name string
+		data string
+		end  int64
+		want []visit
+	}{
+		{"empty", "", 0, nil},
+		{"one line", "a\n", 2, []visit{{"a", 0}}},
+		{"newest first", "a\nbb\nccc\n", 9, []visit{{"ccc", 5}, {"bb", 2}, {"a", 0}}},
+		{"partial line at end", "a\nbb\ncc", 7, []visit{{"bb", 2}, {"a", 0}}},
+		{"end inside a line", "a\nbb\nccc\n", 7, []visit{{"bb", 2}, {"a", 0}}},
+		{"only a partial line", "abc", 3, nil},
+		{"blank lines skipped", "a\n\nb\n", 5, []visit{{"b", 3}, {"a", 0}}},
+		{"line longer than a chunk", "a\n" + long + "\nb\n", int64(len(long)) + 5, []visit{{"b", int64(len(long)) + 3}, {long, 2}, {"a", 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []visit
+			err := reverseLines(writeTempFile(t, tt.data), tt.end, func(line string, offset int64) bool {
+				got = append(got, visit{line, offset})
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReverseLinesStopsEarly(t *testing.T) {
+	var got []string
+	err := reverseLines(writeTempFile(t, "a\nb\nc\n"), 6, func(line string, offset int64) bool {
+		got = append(got, line)
+		return len(got) < 2
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
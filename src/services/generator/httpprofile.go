@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// the 99th percentile of the standard normal distribution
+const normalP99 = 2.3263
+
+// Distribution is a log-normal distribution given by its median and 99th
+// percentile, which is how latencies and sizes are usually quoted.
+type Distribution struct {
+	P50 float64 `yaml:"p50" json:"p50"`
+	P99 float64 `yaml:"p99" json:"p99"`
+}
+
+// EndpointProfile is how one endpoint behaves. Error rates left out fall back
+// to HTTP_ERROR_RATE (5xx) and HTTP_CLIENT_ERROR_RATE (4xx).
+type EndpointProfile struct {
+	Latency         Distribution `yaml:"latency" json:"latency"`
+	Size            Distribution `yaml:"size" json:"size"`
+	ErrorRate       *float64     `yaml:"error_rate" json:"error_rate,omitempty"`
+	ClientErrorRate *float64     `yaml:"client_error_rate" json:"client_error_rate,omitempty"`
+}
+
+// HTTPProfile holds the latency of each service, in milliseconds, and the
+// latency, response size and error rates of each endpoint.
+type HTTPProfile struct {
+	Services  map[string]Distribution    `yaml:"services" json:"services"`
+	Endpoints map[string]EndpointProfile `yaml:"endpoints" json:"endpoints"`
+}
+
+func floatPtr(f float64) *float64 { return &f }
+
+// the endpoints the generator writes by default
+var defaultHTTPProfile = HTTPProfile{
+	Services: map[string]Distribution{},
+	Endpoints: map[string]EndpointProfile{
+		"health":    {Latency: Distribution{2, 15}, Size: Distribution{60, 120}, ErrorRate: floatPtr(0.001), ClientErrorRate: floatPtr(0)},
+		"auth":      {Latency: Distribution{60, 400}, Size: Distribution{300, 900}, ClientErrorRate: floatPtr(0.15)},
+		"search":    {Latency: Distribution{120, 1500}, Size: Distribution{8192, 65536}, ErrorRate: floatPtr(0.02)},
+		"users":     {Latency: Distribution{30, 300}, Size: Distribution{1024, 8192}},
+		"products":  {Latency: Distribution{45, 500}, Size: Distribution{4096, 32768}},
+		"orders":    {Latency: Distribution{90, 1200}, Size: Distribution{2048, 16384}, ErrorRate: floatPtr(0.03)},
+		"api/v1":    {Latency: Distribution{40, 600}, Size: Distribution{512, 8192}},
+		"dashboard": {Latency: Distribution{200, 2500}, Size: Distribution{16384, 131072}},
+		"settings":  {Latency: Distribution{25, 250}, Size: Distribution{512, 4096}},
+	},
+}
+
+// what an endpoint missing from the profile returns
+var defaultResponseSize = Distribution{1024, 16384}
+
+// error pages are small whatever the endpoint
+var errorResponseSize = Distribution{350, 1200}
+
+func LoadHTTPProfile(path string) (*HTTPProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP profile: %w", err)
+	}
+
+	var profile HTTPProfile
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse HTTP profile: %w", err)
+	}
+
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (p *HTTPProfile) Validate() error {
+	for service, latency := range p.Services {
+		if err := latency.Validate(); err != nil {
+			return fmt.Errorf("service %s latency: %w", service, err)
+		}
+	}
+	for endpoint, e := range p.Endpoints {
+		if err := e.Latency.Validate(); err != nil {
+			return fmt.Errorf("endpoint %s latency: %w", endpoint, err)
+		}
+		if e.Size != (Distribution{}) {
+			if err := e.Size.Validate(); err != nil {
+				return fmt.Errorf("endpoint %s size: %w", endpoint, err)
+			}
+		}
+		for _, r := range []*float64{e.ErrorRate, e.ClientErrorRate} {
+			if r != nil && (*r < 0 || *r > 1) {
+				return fmt.Errorf("endpoint %s: error rates must be between 0 and 1", endpoint)
+			}
+		}
+	}
+	return nil
+}
+
+func (d Distribution) Validate() error {
+	if d.P50 <= 0 {
+		return fmt.Errorf("p50 must be positive")
+	}
+	if d.P99 < d.P50 {
+		return fmt.Errorf("p99 must be at least p50")
+	}
+	return nil
+}
+
+// sample draws from the distribution.
+func (lg *LogGenerator) sample(d Distribution) float64 {
+	sigma := math.Log(d.P99/d.P50) / normalP99
+	return d.P50 * math.Exp(sigma*lg.rng.NormFloat64())
+}
+
+// serviceLatency draws a request duration in milliseconds for service.
+func (lg *LogGenerator) serviceLatency(service string) int {
+	d, ok := lg.profile.Services[service]
+	if !ok {
+		d = Distribution{lg.cfg.LatencyP50, lg.cfg.LatencyP99}
+	}
+	return int(math.Max(1, math.Round(lg.sample(d))))
+}
+
+func (lg *LogGenerator) endpointProfile(endpoint string) EndpointProfile {
+	e, ok := lg.profile.Endpoints[endpoint]
+	if !ok {
+		e.Latency = Distribution{lg.cfg.LatencyP50, lg.cfg.LatencyP99}
+	}
+	if e.Size == (Distribution{}) {
+		e.Size = defaultResponseSize
+	}
+	if e.ErrorRate == nil {
+		e.ErrorRate = &lg.cfg.HTTPErrorRate
+	}
+	if e.ClientErrorRate == nil {
+		e.ClientErrorRate = &lg.cfg.HTTPClientErrorRate
+	}
+	return e
+}
+
+// httpResponse decides how a request to endpoint went: its status, the bytes
+// sent back (0 for none) and how long it took. Errors are BURST_ERROR_FACTOR
+// times as likely during a burst.
+func (lg *LogGenerator) httpResponse(method, endpoint string) (status, size int, latency time.Duration) {
+	e := lg.endpointProfile(endpoint)
+
+	errorRate, clientErrorRate := *e.ErrorRate, *e.ClientErrorRate
+	if lg.InBurstMode {
+		errorRate = math.Min(1, errorRate*lg.cfg.BurstErrorFactor)
+		clientErrorRate = math.Min(1-errorRate, clientErrorRate*lg.cfg.BurstErrorFactor)
+	}
+
+	ms := lg.sample(e.Latency)
+	switch r := lg.rng.Float64(); {
+	case r < errorRate:
+		status = []int{500, 500, 502, 503, 504}[lg.rng.Intn(5)]
+		switch status {
+		case 503:
+			// shed before doing any work
+			ms *= 0.1
+		case 504:
+			// the proxy gave up waiting
+			ms = 30000 + lg.rng.Float64()*30000
+		}
+	case r < errorRate+clientErrorRate:
+		status = []int{400, 401, 403, 404, 404, 429}[lg.rng.Intn(6)]
+		ms *= 0.5
+	default:
+		status = lg.successStatus(method)
+	}
+
+	switch {
+	case status == 204 || status == 304:
+		size = 0
+	case status == 301:
+		size = 200 + lg.rng.Intn(100)
+	case status >= 400:
+		size = int(lg.sample(errorResponseSize))
+	default:
+		size = int(lg.sample(e.Size))
+	}
+
+	return status, size, time.Duration(math.Max(ms, 0.05) * float64(time.Millisecond))
+}
+
+func (lg *LogGenerator) successStatus(method string) int {
+	switch method {
+	case "POST":
+		if lg.rng.Float64() < 0.6 {
+			return 201
+		}
+		return 200
+	case "DELETE":
+		return 204
+	case "GET":
+		switch r := lg.rng.Float64(); {
+		case r < 0.07:
+			return 304
+		case r < 0.1:
+			return 301
+		}
+	}
+	return 200
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// quantile returns the q-th quantile of values, sorting them in place.
+func quantile(values []float64, q float64) float64 {
+	sort.Float64s(values)
+	return values[int(q*float64(len(values)-1))]
+}
+
+func TestSampleQuantiles(t *testing.T) {
+	lg := newTestGenerator(t, map[string]string{"SEED": "13"})
+
+	tests := []Distribution{
+		{50, 500},
+		{2, 15},
+		{8192, 65536},
+		{100, 100},
+	}
+	for _, d := range tests {
+		values := make([]float64, 50000)
+		for i := range values {
+			values[i] = lg.sample(d)
+		}
+		p50, p99 := quantile(values, 0.5), quantile(values, 0.99)
+		if math.Abs(p50/d.P50-1) > 0.03 || math.Abs(p99/d.P99-1) > 0.1 {
+			t.Errorf("sampling %+v gave p50 %.1f and p99 %.1f", d, p50, p99)
+		}
+	}
+}
+
+func TestHTTPResponseErrorRates(t *testing.T) {
+	tests := []struct {
+		name        string
+		endpoint    string
+		burst       bool
+		server      float64 // share of 5xx
+		client      float64 // share of 4xx
+		medianMs    float64 // of successful requests
+		medianBytes float64 // of successful requests
+	}{
+		{"health", "health", false, 0.001, 0, 2, 60},
+		{"auth", "auth", false, 0.01, 0.15, 60, 300},
+		{"search", "search", false, 0.02, 0.04, 120, 8192},
+		{"search in a burst", "search", true, 0.06, 0.12, 120, 8192},
+		{"unprofiled endpoint", "reports", false, 0.01, 0.04, 40, 1024},
+		{"unprofiled endpoint in a burst", "reports", true, 0.03, 0.12, 40, 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lg := newTestGenerator(t, map[string]string{
+				"SEED":                   "13",
+				"HTTP_ERROR_RATE":        "0.01",
+				"HTTP_CLIENT_ERROR_RATE": "0.04",
+				"BURST_ERROR_FACTOR":     "3",
+				"LATENCY_P50":            "40",
+				"LATENCY_P99":            "600",
+			})
+			lg.InBurstMode = tt.burst
+
+			const requests = 40000
+			var server, client int
+			var latencies, sizes []float64
+			for i := 0; i < requests; i++ {
+				status, size, latency := lg.httpResponse("PUT", tt.endpoint)
+				switch {
+				case status >= 500:
+					server++
+				case status >= 400:
+					client++
+				default:
+					latencies = append(latencies, float64(latency)/float64(time.Millisecond))
+					sizes = append(sizes, float64(size))
+				}
+			}
+
+			shares := []struct {
+				kind      string
+				got, want float64
+			}{
+				{"5xx", float64(server) / requests, tt.server},
+				{"4xx", float64(client) / requests, tt.client},
+			}
+			for _, s := range shares {
+				if math.Abs(s.got-s.want) > 0.1*s.want+0.002 {
+					t.Errorf("%s share %.4f, want %.4f", s.kind, s.got, s.want)
+				}
+			}
+			if got := quantile(latencies, 0.5); math.Abs(got/tt.medianMs-1) > 0.05 {
+				t.Errorf("median latency %.1fms, want %.1fms", got, tt.medianMs)
+			}
+			if got := quantile(sizes, 0.5); math.Abs(got/tt.medianBytes-1) > 0.05 {
+				t.Errorf("median size %.0f bytes, want %.0f", got, tt.medianBytes)
+			}
+		})
+	}
+}
+
+func TestHTTPResponseShape(t *testing.T) {
+	lg := newTestGenerator(t, map[string]string{
+		"SEED":                   "13",
+		"HTTP_ERROR_RATE":        "0.3",
+		"HTTP_CLIENT_ERROR_RATE": "0.3",
+	})
+
+	methods := []string{"GET", "POST", "PUT", "DELETE"}
+	seen := map[int]bool{}
+	for i := 0; i < 20000; i++ {
+		method := methods[i%len(methods)]
+		status, size, latency := lg.httpResponse(method, "users")
+		seen[status] = true
+
+		switch {
+		case status == 504:
+			if latency < 30*time.Second || latency > 60*time.Second {
+				t.Fatalf("504 after %v, want the proxy's 30-60s timeout", latency)
+			}
+		case status == 204 || status == 304:
+			if size != 0 {
+				t.Fatalf("%d with %d bytes", status, size)
+			}
+		}
+		if status == 201 && method != "POST" || status == 204 && method != "DELETE" || (status == 301 || status == 304) && method != "GET" {
+			t.Fatalf("%s answered %d", method, status)
+		}
+		if status >= 400 && size > 10000 {
+			t.Fatalf("%d error page of %d bytes", status, size)
+		}
+		if latency <= 0 {
+			t.Fatalf("%d took %v", status, latency)
+		}
+	}
+
+	for _, status := range []int{200, 201, 204, 301, 304, 400, 401, 403, 404, 429, 500, 502, 503, 504} {
+		if !seen[status] {
+			t.Errorf("never answered %d", status)
+		}
+	}
+}
+
+func TestServiceLatency(t *testing.T) {
+	file := writeTempFile(t, "services:\n  payment-service: {p50: 150, p99: 2000}\nendpoints: {}\n")
+	lg := newTestGenerator(t, map[string]string{
+		"SEED":              "13",
+		"HTTP_PROFILE_FILE": file.Name(),
+		"LATENCY_P50":       "40",
+		"LATENCY_P99":       "600",
+	})
+
+	tests := []struct {
+		service string
+		p50     float64
+	}{
+		{"payment-service", 150},
+		{"user-service", 40},
+	}
+	for _, tt := range tests {
+		values := make([]float64, 20000)
+		for i := range values {
+			ms := lg.serviceLatency(tt.service)
+			if ms < 1 {
+				t.Fatalf("%s took %dms", tt.service, ms)
+			}
+			values[i] = float64(ms)
+		}
+		if got := quantile(values, 0.5); math.Abs(got/tt.p50-1) > 0.05 {
+			t.Errorf("%s median %.0fms, want %.0fms", tt.service, got, tt.p50)
+		}
+	}
+}
+
+func TestLoadHTTPProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{name: "valid", yaml: "services:\n  a: {p50: 10, p99: 100}\nendpoints:\n  health: {latency: {p50: 1, p99: 1}, error_rate: 0}\n"},
+		{name: "service median not positive", yaml: "services:\n  a: {p50: 0, p99: 100}\n", wantErr: "service a latency: p50 must be positive"},
+		{name: "p99 below median", yaml: "endpoints:\n  search: {latency: {p50: 100, p99: 10}}\n", wantErr: "endpoint search latency: p99 must be at least p50"},
+		{name: "bad size", yaml: "endpoints:\n  search: {latency: {p50: 1, p99: 2}, size: {p50: 10, p99: 1}}\n", wantErr: "endpoint search size"},
+		{name: "error rate above 1", yaml: "endpoints:\n  search: {latency: {p50: 1, p99: 2}, error_rate: 1.5}\n", wantErr: "error rates must be between 0 and 1"},
+		{name: "negative client error rate", yaml: "endpoints:\n  search: {latency: {p50: 1, p99: 2}, client_error_rate: -0.1}\n", wantErr: "error rates must be between 0 and 1"},
+		{name: "not yaml", yaml: "services: [", wantErr: "failed to parse HTTP profile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeTempFile(t, tt.yaml)
+			_, err := LoadHTTPProfile(file.Name())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadHTTPProfile() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApacheLineResponseTime(t *testing.T) {
+	lg := newTestGenerator(t, nil)
+	at := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		status  int
+		size    int
+		latency time.Duration
+		want    string // the line after the client and time
+		micros  string // %D
+	}{
+		{200, 512, 42 * time.Millisecond, `"GET /users HTTP/1.1" 200 512 "-" "curl/8.0" 42000`, "42000"},
+		{204, 0, 1500 * time.Microsecond, `"GET /users HTTP/1.1" 204 - "-" "curl/8.0" 1500`, "1500"},
+		{504, 400, 31 * time.Second, `"GET /users HTTP/1.1" 504 400 "-" "curl/8.0" 31000000`, "31000000"},
+	}
+	for _, tt := range tests {
+		line := lg.apacheLine("10.0.0.2", at, "GET", "users", "HTTP/1.1", tt.status, tt.size, "curl/8.0", tt.latency)
+		if want := "10.0.0.2 - - [01/Sep/2026:10:00:00 +0000] " + tt.want; line != want {
+			t.Errorf("apacheLine() = %s, want %s", line, want)
+		}
+		if m := apacheLinePattern.FindStringSubmatch(line); m == nil || m[10] != tt.micros {
+			t.Errorf("response time of %s does not parse: %q", line, m)
+		}
+	}
+}
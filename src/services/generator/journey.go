@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JourneyModel is a Markov chain over user session states. Each state lists
+// the states a user may move to next with their probabilities; states without
+// transitions end the session.
+type JourneyModel struct {
+	Initial     string                        `yaml:"initial" json:"initial"`
+	Transitions map[string]map[string]float64 `yaml:"transitions" json:"transitions"`
+
+	// Messages and Levels describe what is logged when a user enters a state.
+	// States without a level use the configured LOG_DISTRIBUTION.
+	Messages map[string]string `yaml:"messages" json:"messages"`
+	Levels   map[string]string `yaml:"levels" json:"levels"`
+}
+
+var defaultJourneyModel = JourneyModel{
+	Initial: "login",
+	Transitions: map[string]map[string]float64{
+		"login":          {"browse": 0.6, "search": 0.35, "logout": 0.05},
+		"browse":         {"search": 0.3, "view_item": 0.5, "logout": 0.1, "browse": 0.1},
+		"search":         {"view_item": 0.6, "browse": 0.2, "search": 0.15, "logout": 0.05},
+		"view_item":      {"add_to_cart": 0.35, "browse": 0.3, "search": 0.25, "logout": 0.1},
+		"add_to_cart":    {"checkout": 0.5, "browse": 0.2, "view_item": 0.1, "abandon_cart": 0.2},
+		"checkout":       {"purchase": 0.75, "payment_error": 0.15, "abandon_cart": 0.1},
+		"payment_error":  {"retry_checkout": 0.6, "abandon_cart": 0.4},
+		"retry_checkout": {"purchase": 0.7, "payment_error": 0.3},
+		"purchase":       {"browse": 0.2, "logout": 0.8},
+	},
+	Messages: map[string]string{
+		"login":          "User logged in successfully",
+		"browse":         "User browsing product catalog",
+		"search":         "User performed search query",
+		"view_item":      "User viewing product details",
+		"add_to_cart":    "User added item to cart",
+		"checkout":       "User initiated checkout process",
+		"payment_error":  "Payment authorization failed during checkout",
+		"retry_checkout": "User retrying checkout after failed payment",
+		"abandon_cart":   "User abandoned cart",
+		"purchase":       "User completed purchase",
+		"logout":         "User logged out",
+	},
+	Levels: map[string]string{
+		"payment_error":  ERROR,
+		"retry_checkout": WARNING,
+	},
+}
+
+func LoadJourneyModel(path string) (*JourneyModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journey model: %w", err)
+	}
+
+	var model JourneyModel
+	if err := yaml.Unmarshal(data, &model); err != nil {
+		return nil, fmt.Errorf("failed to parse journey model: %w", err)
+	}
+
+	if err := model.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+func (m *JourneyModel) Validate() error {
+	if m.Initial == "" {
+		return fmt.Errorf("journey model has no initial state")
+	}
+	if _, ok := m.Transitions[m.Initial]; !ok {
+		return fmt.Errorf("initial state %q has no transitions", m.Initial)
+	}
+
+	for state, next := range m.Transitions {
+		total := 0.0
+		for target, p := range next {
+			if p < 0 {
+				return fmt.Errorf("state %q: negative probability for %q", state, target)
+			}
+			total += p
+		}
+		if len(next) > 0 && total == 0 {
+			return fmt.Errorf("state %q: transition probabilities sum to zero", state)
+		}
+	}
+
+	for state, level := range m.Levels {
+		if !isLogLevel(level) {
+			return fmt.Errorf("state %q: unknown log level %q", state, level)
+		}
+	}
+
+	return nil
+}
+
+// Next picks the state that follows current, with r a uniform number in
+// [0, 1). ok is false when current is terminal.
+func (m *JourneyModel) Next(current string, r float64) (next string, ok bool) {
+	transitions := m.Transitions[current]
+	if len(transitions) == 0 {
+		return "", false
+	}
+
+	// fixed order so seeded runs take the same paths
+	states := make([]string, 0, len(transitions))
+	total := 0.0
+	for state, p := range transitions {
+		states = append(states, state)
+		total += p
+	}
+	sort.Strings(states)
+
+	r *= total
+	for _, state := range states {
+		if r < transitions[state] {
+			return state, true
+		}
+		r -= transitions[state]
+	}
+	return states[len(states)-1], true
+}
+
+func (m *JourneyModel) Message(state string) string {
+	if msg, ok := m.Messages[state]; ok {
+		return msg
+	}
+	return "User session entered " + state
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestJourneyNext(t *testing.T) {
+	model := JourneyModel{
+		Initial: "a",
+		Transitions: map[string]map[string]float64{
+			"a": {"c": 0.75, "b": 0.25},
+			// weights need not add up to 1
+			"b": {"c": 3, "a": 1},
+		},
+	}
+
+	tests := []struct {
+		current string
+		r       float64
+		want    string
+		ok      bool
+	}{
+		{"a", 0, "b", true},
+		{"a", 0.2499, "b", true},
+		{"a", 0.25, "c", true},
+		{"a", 0.9999, "c", true},
+		{"b", 0.2499, "a", true},
+		{"b", 0.25, "c", true},
+		{"c", 0.5, "", false},
+		{"unknown", 0.5, "", false},
+	}
+
+	for _, tt := range tests {
+		next, ok := model.Next(tt.current, tt.r)
+		if next != tt.want || ok != tt.ok {
+			t.Errorf("Next(%s, %v) = %q, %v, want %q, %v", tt.current, tt.r, next, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestJourneyTransitionsFollowProbabilities(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	const draws = 20000
+
+	for _, state := range []string{"login", "checkout", "payment_error"} {
+		counts := map[string]int{}
+		for i := 0; i < draws; i++ {
+			next, ok := defaultJourneyModel.Next(state, rng.Float64())
+			if !ok {
+				t.Fatalf("%s is terminal", state)
+			}
+			counts[next]++
+		}
+
+		for next, p := range defaultJourneyModel.Transitions[state] {
+			got := float64(counts[next]) / draws
+			if got < p-0.015 || got > p+0.015 {
+				t.Errorf("%s -> %s taken %.3f of the time, want %.2f", state, next, got, p)
+			}
+		}
+		if len(counts) != len(defaultJourneyModel.Transitions[state]) {
+			t.Errorf("%s moved to %v, outside its transitions", state, counts)
+		}
+	}
+}
+
+func TestLoadJourneyModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			yaml: "initial: start\ntransitions:\n  start: {end: 1}\nlevels:\n  end: ERROR\n",
+		},
+		{
+			name:    "no initial state",
+			yaml:    "transitions:\n  start: {end: 1}\n",
+			wantErr: "no initial state",
+		},
+		{
+			name:    "initial state without transitions",
+			yaml:    "initial: start\ntransitions:\n  other: {end: 1}\n",
+			wantErr: `initial state "start" has no transitions`,
+		},
+		{
+			name:    "negative probability",
+			yaml:    "initial: start\ntransitions:\n  start: {end: -1, other: 2}\n",
+			wantErr: "negative probability",
+		},
+		{
+			name:    "probabilities sum to zero",
+			yaml:    "initial: start\ntransitions:\n  start: {end: 0}\n",
+			wantErr: "sum to zero",
+		},
+		{
+			name:    "unknown level",
+			yaml:    "initial: start\ntransitions:\n  start: {end: 1}\nlevels:\n  end: error\n",
+			wantErr: `unknown log level "error"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeTempFile(t, tt.yaml)
+			_, err := LoadJourneyModel(file.Name())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadJourneyModel() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJourneyMessage(t *testing.T) {
+	if got := defaultJourneyModel.Message("purchase"); got != "User completed purchase" {
+		t.Errorf("Message(purchase) = %q", got)
+	}
+	if got := defaultJourneyModel.Message("wishlist"); got != "User session entered wishlist" {
+		t.Errorf("Message(wishlist) = %q", got)
+	}
+}
+
+func TestSessionsMoveAlongTransitions(t *testing.T) {
+	lg := newTestGenerator(t, map[string]string{
+		"SEED":             "4",
+		"FAKE_CLOCK_START": "2026-09-01T10:00:00Z",
+		"ACTIVE_USERS":     "5",
+	})
+
+	type step struct{ session, state string }
+	last := map[string]step{}
+	restarts := 0
+	for i := 0; i < 2000; i++ {
+		session := lg.advanceUserSession()
+		prev, seen := last[session.UserID]
+		last[session.UserID] = step{session.SessionID, session.State}
+
+		switch {
+		case !seen:
+			if session.State != defaultJourneyModel.Initial {
+				t.Fatalf("%s starts at %s, want %s", session.UserID, session.State, defaultJourneyModel.Initial)
+			}
+		case session.SessionID != prev.session:
+			// only a terminal state starts a new session, at the initial state
+			if len(defaultJourneyModel.Transitions[prev.state]) != 0 || session.State != defaultJourneyModel.Initial {
+				t.Fatalf("%s started over from %s at %s", session.UserID, prev.state, session.State)
+			}
+			restarts++
+		default:
+			if _, ok := defaultJourneyModel.Transitions[prev.state][session.State]; !ok {
+				t.Fatalf("%s moved from %s to %s, which is not a transition", session.UserID, prev.state, session.State)
+			}
+		}
+	}
+	if len(last) != 5 || restarts == 0 {
+		t.Errorf("%d users with %d new sessions, want 5 users returning for new sessions", len(last), restarts)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Format writes lines in one log layout. Formats passed to RegisterFormat can
+// be selected in LOG_FORMAT like the built-in ones.
+type Format interface {
+	Name() string
+	// Generate returns the next entry: one line, or several joined by
+	// newlines when an entry spans lines.
+	Generate(ctx FormatContext) string
+	// Sample is an example line, listed by GET /formats.
+	Sample() string
+}
+
+// FormatContext gives a format what the built-in ones draw on. It is only
+// valid during the Generate call it is passed to.
+type FormatContext struct {
+	lg    *LogGenerator
+	route *entryRoute
+}
+
+// Now is the generator's clock, which is simulated in seeded runs.
+func (ctx FormatContext) Now() time.Time { return ctx.lg.clock.Now() }
+
+// Rand is the generator's random source. Drawing only from it keeps seeded
+// runs reproducible.
+func (ctx FormatContext) Rand() *rand.Rand { return ctx.lg.rng }
+
+func (ctx FormatContext) Config() Config { return ctx.lg.cfg }
+
+// Event returns the next service event: a service, level, host, user session
+// step, request id, duration and message, recorded in the statistics. In the
+// per_service layout the entry is filed under the event's host and service.
+func (ctx FormatContext) Event() LogEvent { return ctx.lg.newEvent(ctx.route) }
+
+// FormatInfo describes a registered format for GET /formats.
+type FormatInfo struct {
+	Name   string `json:"name"`
+	Sample string `json:"sample"`
+}
+
+var formatRegistry = struct {
+	sync.RWMutex
+	formats map[string]Format
+}{formats: make(map[string]Format)}
+
+// RegisterFormat makes f selectable by its name, which is matched case
+// insensitively. It panics when the name is empty or already taken.
+func RegisterFormat(f Format) {
+	name := strings.ToLower(f.Name())
+	if name == "" || strings.ContainsAny(name, ",: ") {
+		panic(fmt.Sprintf("invalid log format name %q", f.Name()))
+	}
+
+	formatRegistry.Lock()
+	defer formatRegistry.Unlock()
+	if _, taken := formatRegistry.formats[name]; taken {
+		panic("log format " + name + " registered twice")
+	}
+	formatRegistry.formats[name] = f
+}
+
+func LookupFormat(name string) (Format, bool) {
+	formatRegistry.RLock()
+	defer formatRegistry.RUnlock()
+	f, ok := formatRegistry.formats[strings.ToLower(name)]
+	return f, ok
+}
+
+// RegisteredFormats lists every format, ordered by name.
+func RegisteredFormats() []FormatInfo {
+	formatRegistry.RLock()
+	formats := make(map[string]Format, len(formatRegistry.formats))
+	for name, f := range formatRegistry.formats {
+		formats[name] = f
+	}
+	formatRegistry.RUnlock()
+
+	// samples are taken outside the lock, as the built-in ones look formats up
+	infos := make([]FormatInfo, 0, len(formats))
+	for name, f := range formats {
+		infos = append(infos, FormatInfo{Name: name, Sample: f.Sample()})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+func formatNames() []string {
+	infos := RegisteredFormats()
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name
+	}
+	return names
+}
+
+// builtinFormat is a format written by one of the generator's own methods.
+type builtinFormat struct {
+	name     string
+	generate func(lg *LogGenerator, route *entryRoute) string
+}
+
+func (f builtinFormat) Name() string                      { return f.name }
+func (f builtinFormat) Generate(ctx FormatContext) string { return f.generate(ctx.lg, ctx.route) }
+
+func (f builtinFormat) Sample() string {
+	builtinSamples.once.Do(generateBuiltinSamples)
+	return builtinSamples.lines[f.name]
+}
+
+var builtinFormats = []builtinFormat{
+	{"apache", (*LogGenerator).generateApacheLog},
+	{"nginx", (*LogGenerator).generateNginxLog},
+	{"app", (*LogGenerator).generateAppLog},
+	{"json", (*LogGenerator).generateJSONEntry},
+	{"syslog3164", (*LogGenerator).generateSyslog3164Log},
+	{"syslog5424", (*LogGenerator).generateSyslog5424Log},
+	{"logfmt", (*LogGenerator).generateLogfmtLog},
+	{"docker", (*LogGenerator).generateDockerLog},
+	{"cri", (*LogGenerator).generateCRILog},
+}
+
+// the seed and clock the built-in sample lines are generated with
+const (
+	sampleSeed = 1
+	sampleTime = "2025-10-17T14:03:05Z"
+)
+
+var builtinSamples struct {
+	once  sync.Once
+	lines map[string]string
+}
+
+// generateBuiltinSamples writes a line of each built-in format with a fixed
+// seed and clock from the default configuration, so GET /formats shows what
+// the generator really writes and the samples stay the same from call to call
+// whatever the environment. The defaults leave out faults, PII, attacks,
+// traces and stack traces.
+func generateBuiltinSamples() {
+	base := DefaultConfig()
+	base.Seed, base.FakeClockStart = sampleSeed, sampleTime
+	base.OutputFile, base.ConsoleOutput = "", false
+
+	builtinSamples.lines = make(map[string]string, len(builtinFormats))
+	for _, f := range builtinFormats {
+		cfg := base
+		cfg.LogFormat = f.name
+		lg, err := NewLogGenerator(cfg)
+		if err != nil {
+			log.Printf("failed to generate a sample %s line: %v", f.name, err)
+			continue
+		}
+		builtinSamples.lines[f.name] = f.generate(lg, nil)
+	}
+}
+
+func init() {
+	for _, f := range builtinFormats {
+		RegisterFormat(f)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuiltinSamples(t *testing.T) {
+	at, err := time.Parse(time.RFC3339, sampleTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos := RegisteredFormats()
+	samples := make(map[string]string, len(infos))
+	for _, info := range infos {
+		samples[info.Name] = info.Sample
+	}
+
+	for _, f := range builtinFormats {
+		t.Run(f.name, func(t *testing.T) {
+			sample := samples[f.name]
+			if sample == "" || strings.Contains(sample, "\n") {
+				t.Fatalf("sample %q is not one line", sample)
+			}
+			if again := f.Sample(); again != sample {
+				t.Errorf("sample changed from %q to %q", sample, again)
+			}
+
+			r, ok := parseLogLine(sample, at)
+			if !ok || r.Format != f.name {
+				t.Fatalf("sample %q parses as %q", sample, r.Format)
+			}
+			if !r.Timestamp.Equal(at) {
+				t.Errorf("sample is dated %s, want %s", r.Timestamp, at)
+			}
+		})
+	}
+}
+
+func TestBuiltinSamplesIgnoreEnvironment(t *testing.T) {
+	RegisteredFormats()
+	before := builtinSamples.lines
+	t.Cleanup(func() { builtinSamples.lines = before })
+
+	t.Setenv("SERVICES", "env-only-service")
+	t.Setenv("LOG_DIST_INFO", "0")
+	generateBuiltinSamples()
+
+	for _, f := range builtinFormats {
+		if got := builtinSamples.lines[f.name]; got != before[f.name] {
+			t.Errorf("%s: sample changed with the environment from %q to %q", f.name, before[f.name], got)
+		}
+	}
+}
+
+func TestDefaultConfigIgnoresEnvironment(t *testing.T) {
+	t.Setenv("LOG_RATE", "99")
+
+	if rate := DefaultConfig().LogRate; rate != 5 {
+		t.Errorf("DefaultConfig().LogRate = %d, want the default 5", rate)
+	}
+	if rate := LoadConfig().LogRate; rate != 99 {
+		t.Errorf("LoadConfig().LogRate = %d after DefaultConfig, want 99 from the environment", rate)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	apacheLinePattern     = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)(?: ([^"]*))?" (\d{3}) (\d+|-)(?: "([^"]*)" "([^"]*)")?(?: (\d+))?`)
+	nginxLinePattern      = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(\w+)\] ([^:]+): (.*)$`)
+	appLinePattern        = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2}T[^\]]+)\] (\w+) \[([^\]]+)\] (.*)$`)
+	syslog3164LinePattern = regexp.MustCompile(`^<(\d{1,3})>(\w{3} [ \d]\d \d{2}:\d{2}:\d{2}) (\S+) ([^\[:]+)\[(\d+)\]: (.*)$`)
+	syslog5424LinePattern = regexp.MustCompile(`^<(\d{1,3})>1 (\S+) (\S+) (\S+) (\S+) (\S+) (-|\[(?:[^\]\\]|\\.)*\]) ?(.*)$`)
+	criLinePattern        = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\S+) (stdout|stderr) ([FP]) (.*)$`)
+	logfmtPairPattern     = regexp.MustCompile(`(\w+)=("(?:[^"\\]|\\.)*"|\S*)`)
+	sdParamPattern        = regexp.MustCompile(`(\w+)="((?:[^"\\]|\\.)*)"`)
+)
+
+var nginxLevels = map[string]string{
+	"debug": DEBUG,
+	"info":  INFO,
+	"warn":  WARNING,
+	"error": ERROR,
+	"crit":  CRITICAL,
+}
+
+// parseLogLine turns one line of any emitted format back into a record. now
+// supplies the year for RFC 3164 timestamps and the zone for nginx ones, which
+// carry neither. Lines that match no format, such as stack trace frames, are
+// reported as not ok.
+func parseLogLine(line string, now time.Time) (LogRecord, bool) {
+	switch {
+	case strings.HasPrefix(line, "{"):
+		return parseJSONLine(line, now)
+	case strings.HasPrefix(line, "<"):
+		if r, ok := parseSyslog5424Line(line); ok {
+			return r, true
+		}
+		return parseSyslog3164Line(line, now)
+	case strings.HasPrefix(line, "["):
+		return parseAppLine(line)
+	case strings.HasPrefix(line, "time="):
+		return parseLogfmtLine(line)
+	}
+
+	if r, ok := parseCRILine(line); ok {
+		return r, true
+	}
+	if r, ok := parseNginxLine(line, now); ok {
+		return r, true
+	}
+	return parseApacheLine(line)
+}
+
+func parseApacheLine(line string) (LogRecord, bool) {
+	m := apacheLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return LogRecord{}, false
+	}
+	ts, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[2])
+	if err != nil {
+		return LogRecord{}, false
+	}
+	status, _ := strconv.Atoi(m[6])
+
+	record := LogRecord{
+		Timestamp: ts,
+		Format:    "apache",
+		LogType:   statusLevel(status),
+		Message:   strings.TrimSpace(m[3] + " " + m[4] + " " + m[5]),
+		Fields: map[string]string{
+			"ip":         m[1],
+			"method":     m[3],
+			"path":       m[4],
+			"status":     m[6],
+			"size":       m[7],
+			"referer":    m[8],
+			"user_agent": m[9],
+		},
+		Raw: line,
+	}
+	// %D, the response time in microseconds
+	if m[10] != "" {
+		us, _ := strconv.Atoi(m[10])
+		record.Duration = us / 1000
+		record.Fields["response_time_us"] = m[10]
+	}
+	return record, true
+}
+
+func parseNginxLine(line string, now time.Time) (LogRecord, bool) {
+	m := nginxLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return LogRecord{}, false
+	}
+	ts, err := time.ParseInLocation("2006/01/02 15:04:05", m[1], now.Location())
+	if err != nil {
+		return LogRecord{}, false
+	}
+	level, ok := nginxLevels[m[2]]
+	if !ok {
+		level = strings.ToUpper(m[2])
+	}
+
+	return LogRecord{
+		Timestamp: ts,
+		Format:    "nginx",
+		LogType:   level,
+		Message:   m[4],
+		Fields:    map[string]string{"process": m[3]},
+		Raw:       line,
+	}, true
+}
+
+func parseAppLine(line string) (LogRecord, bool) {
+	m := appLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return LogRecord{}, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, m[1])
+	if err != nil {
+		return LogRecord{}, false
+	}
+
+	return LogRecord{
+		Timestamp: ts,
+		Format:    "app",
+		LogType:   m[2],
+		Service:   m[3],
+		Message:   m[4],
+		Raw:       line,
+	}, true
+}
+
+// parseJSONLine handles our own JSON entries and Docker json-file lines, which
+// wrap an app line.
+func parseJSONLine(line string, now time.Time) (LogRecord, bool) {
+	var docker DockerLogEntry
+	if err := json.Unmarshal([]byte(line), &docker); err == nil && docker.Log != "" && docker.Time != "" {
+		ts, err := time.Parse(time.RFC3339Nano, docker.Time)
+		if err != nil {
+			return LogRecord{}, false
+		}
+		r, ok := parseAppLine(strings.TrimRight(docker.Log, "\n"))
+		if !ok {
+			r = LogRecord{Message: strings.TrimRight(docker.Log, "\n")}
+		}
+		r.Timestamp = ts
+		r.Format = "docker"
+		r.Fields = map[string]string{"stream": docker.Stream}
+		r.Raw = line
+		return r, true
+	}
+
+	var entry LogEntry
+	if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Timestamp == "" {
+		return LogRecord{}, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+	if err != nil {
+		return LogRecord{}, false
+	}
+
+	var fields map[string]string
+	if entry.Event != "" {
+		fields = map[string]string{"event": entry.Event}
+	}
+
+	return LogRecord{
+		Timestamp:    ts,
+		Format:       "json",
+		LogType:      entry.LogType,
+		Service:      entry.Service,
+		Host:         entry.Host,
+		UserID:       entry.UserID,
+		SessionID:    entry.SessionID,
+		RequestID:    entry.RequestID,
+		TraceID:      entry.TraceID,
+		SpanID:       entry.SpanID,
+		ParentSpanID: entry.ParentSpanID,
+		Duration:     entry.Duration,
+		Message:      entry.Message,
+		StackTrace:   entry.StackTrace,
+		Fields:       fields,
+		Raw:          line,
+	}, true
+}
+
+func parseSyslog3164Line(line string, now time.Time) (LogRecord, bool) {
+	m := syslog3164LinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return LogRecord{}, false
+	}
+	ts, err := time.ParseInLocation(time.Stamp, m[2], now.Location())
+	if err != nil {
+		return LogRecord{}, false
+	}
+	ts = ts.AddDate(now.Year(), 0, 0)
+	// a December line read in January belongs to the year before
+	if ts.After(now.AddDate(0, 1, 0)) {
+		ts = ts.AddDate(-1, 0, 0)
+	}
+
+	return LogRecord{
+		Timestamp: ts,
+		Format:    "syslog3164",
+		LogType:   syslogLevel(m[1]),
+		Service:   m[4],
+		Host:      m[3],
+		Message:   m[6],
+		Fields:    map[string]string{"pid": m[5]},
+		Raw:       line,
+	}, true
+}
+
+func parseSyslog5424Line(line string) (LogRecord, bool) {
+	m := syslog5424LinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return LogRecord{}, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, m[2])
+	if err != nil {
+		return LogRecord{}, false
+	}
+
+	r := LogRecord{
+		Timestamp: ts,
+		Format:    "syslog5424",
+		LogType:   m[6],
+		Service:   m[4],
+		Host:      m[3],
+		Message:   m[8],
+		Fields:    map[string]string{"pid": m[5]},
+		Raw:       line,
+	}
+	if !isLogLevel(r.LogType) {
+		r.LogType = syslogLevel(m[1])
+	}
+
+	for _, p := range sdParamPattern.FindAllStringSubmatch(m[7], -1) {
+		value := strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\]`, `]`).Replace(p[2])
+		switch p[1] {
+		case "userId":
+			r.UserID = value
+		case "sessionId":
+			r.SessionID = value
+		case "requestId":
+			r.RequestID = value
+		case "duration":
+			r.Duration, _ = strconv.Atoi(value)
+		default:
+			r.Fields[p[1]] = value
+		}
+	}
+	return r, true
+}
+
+func parseLogfmtLine(line string) (LogRecord, bool) {
+	r := LogRecord{Format: "logfmt", Fields: map[string]string{}, Raw: line}
+
+	for _, p := range logfmtPairPattern.FindAllStringSubmatch(line, -1) {
+		value := p[2]
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return LogRecord{}, false
+			}
+			value = unquoted
+		}
+
+		switch p[1] {
+		case "time":
+			ts, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return LogRecord{}, false
+			}
+			r.Timestamp = ts
+		case "level":
+			r.LogType = strings.ToUpper(value)
+		case "service":
+			r.Service = value
+		case "host":
+			r.Host = value
+		case "user_id":
+			r.UserID = value
+		case "session_id":
+			r.SessionID = value
+		case "request_id":
+			r.RequestID = value
+		case "duration":
+			r.Duration, _ = strconv.Atoi(value)
+		case "msg":
+			r.Message = value
+		default:
+			r.Fields[p[1]] = value
+		}
+	}
+
+	if r.Timestamp.IsZero() {
+		return LogRecord{}, false
+	}
+	if len(r.Fields) == 0 {
+		r.Fields = nil
+	}
+	return r, true
+}
+
+// parseCRILine handles CRI container log lines, which wrap an app line.
+func parseCRILine(line string) (LogRecord, bool) {
+	m := criLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return LogRecord{}, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, m[1])
+	if err != nil {
+		return LogRecord{}, false
+	}
+
+	r, ok := parseAppLine(m[4])
+	if !ok {
+		r = LogRecord{Message: m[4]}
+	}
+	r.Timestamp = ts
+	r.Format = "cri"
+	r.Fields = map[string]string{"stream": m[2]}
+	r.Raw = line
+	return r, true
+}
+
+// syslogLevel maps the severity in a syslog priority back to a log level.
+func syslogLevel(pri string) string {
+	value, _ := strconv.Atoi(pri)
+	severity := value % 8
+	for level, s := range syslogSeverity {
+		if s == severity {
+			return level
+		}
+	}
+	return INFO
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogLineRoundTrip(t *testing.T) {
+	start := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := []struct {
+		format string
+		// which of the route's fields the format writes
+		service, host bool
+	}{
+		{"apache", false, false},
+		{"nginx", false, false},
+		{"app", true, false},
+		{"json", true, true},
+		{"syslog3164", true, true},
+		{"syslog5424", true, true},
+		{"logfmt", true, true},
+		{"docker", true, false},
+		{"cri", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			lg := newTestGenerator(t, map[string]string{
+				"SEED":              "7",
+				"FAKE_CLOCK_START":  start.Format(time.RFC3339),
+				"LOG_FORMAT":        tt.format,
+				"HOST_COUNT":        "3",
+				"TRACE_PROBABILITY": "0",
+			})
+
+			for i := 0; i < 20; i++ {
+				entry := lg.generateLogMessage()
+				line, _, _ := strings.Cut(entry.text, "\n")
+				route := entry.route.line(0)
+
+				r, ok := parseLogLine(line, start)
+				if !ok {
+					t.Fatalf("could not parse %q", line)
+				}
+				if r.Format != tt.format {
+					t.Errorf("format %q, want %q: %s", r.Format, tt.format, line)
+				}
+				if !r.Timestamp.Equal(start) {
+					t.Errorf("timestamp %s, want %s: %s", r.Timestamp, start, line)
+				}
+				if !isLogLevel(r.LogType) {
+					t.Errorf("level %q: %s", r.LogType, line)
+				}
+				if tt.service && r.Service != route.Service {
+					t.Errorf("service %q, want %q: %s", r.Service, route.Service, line)
+				}
+				if tt.host && r.Host != route.Host {
+					t.Errorf("host %q, want %q: %s", r.Host, route.Host, line)
+				}
+				if r.Raw != line {
+					t.Errorf("raw %q, want %q", r.Raw, line)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLogLineRejectsFrames(t *testing.T) {
+	for _, line := range []string{
+		"    at com.example.UserService.handle(UserService.java:42)",
+		`  File "/app/handlers.py", line 17, in handle`,
+		"goroutine 1 [running]:",
+		"",
+	} {
+		if r, ok := parseLogLine(line, time.Now()); ok {
+			t.Errorf("parsed %q as %s", line, r.Format)
+		}
+	}
+}
+
+func TestParseSyslog3164Year(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+		line string
+		want time.Time
+	}{
+		{
+			"same day",
+			time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC),
+			"<134>Jun 15 11:59:00 web-01 user-service[42]: ok",
+			time.Date(2026, 6, 15, 11, 59, 0, 0, time.UTC),
+		},
+		{
+			"december read in january",
+			time.Date(2027, 1, 1, 0, 0, 5, 0, time.UTC),
+			"<134>Dec 31 23:59:58 web-01 user-service[42]: ok",
+			time.Date(2026, 12, 31, 23, 59, 58, 0, time.UTC),
+		},
+		{
+			"january read in december",
+			time.Date(2026, 12, 31, 23, 59, 58, 0, time.UTC),
+			"<134>Jan  1 00:00:05 web-01 user-service[42]: ok",
+			time.Date(2026, 1, 1, 0, 0, 5, 0, time.UTC),
+		},
+		{
+			"less than a month ahead",
+			time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC),
+			"<134>Feb 10 08:00:00 web-01 user-service[42]: ok",
+			time.Date(2026, 2, 10, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			"more than a month ahead",
+			time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC),
+			"<134>Mar 10 08:00:00 web-01 user-service[42]: ok",
+			time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, ok := parseLogLine(tt.line, tt.now)
+			if !ok {
+				t.Fatalf("could not parse %q", tt.line)
+			}
+			if !r.Timestamp.Equal(tt.want) {
+				t.Errorf("timestamp %s, want %s", r.Timestamp, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultLogsLimit = 10
+	maxLogsLimit     = 1000
+
+	// how often /logs/stream checks the output file for new lines
+	followPollInterval = 250 * time.Millisecond
+	streamKeepAlive    = 15 * time.Second
+)
+
+// logFilter narrows the lines returned by /logs and /logs/stream. Empty fields
+// match everything.
+type logFilter struct {
+	levels   []string
+	services []string
+	formats  []string
+	from     time.Time
+	to       time.Time
+}
+
+// parseLogFilter reads the level, service, format, from and to query
+// parameters. The first three take comma separated lists, from and to take
+// RFC 3339 timestamps.
+func parseLogFilter(c *gin.Context) (logFilter, error) {
+	var filter logFilter
+
+	for _, level := range queryList(c, "level") {
+		level = strings.ToUpper(level)
+		if !isLogLevel(level) {
+			return filter, fmt.Errorf("unknown level %q", level)
+		}
+		filter.levels = append(filter.levels, level)
+	}
+
+	filter.services = queryList(c, "service")
+
+	for _, format := range queryList(c, "format") {
+		if !isLogFormat(format) {
+			return filter, fmt.Errorf("unknown format %q", format)
+		}
+		filter.formats = append(filter.formats, format)
+	}
+
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.from, err = time.Parse(time.RFC3339Nano, from); err != nil {
+			return filter, fmt.Errorf("from must be an RFC 3339 timestamp")
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.to, err = time.Parse(time.RFC3339Nano, to); err != nil {
+			return filter, fmt.Errorf("to must be an RFC 3339 timestamp")
+		}
+	}
+	if !filter.from.IsZero() && !filter.to.IsZero() && filter.to.Before(filter.from) {
+		return filter, fmt.Errorf("to must not be before from")
+	}
+
+	return filter, nil
+}
+
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, param := range c.QueryArray(key) {
+		for _, value := range strings.Split(param, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// logPath returns the file that /logs and /logs/stream read: OUTPUT_FILE, or
+// in the per_service layout <OUTPUT_DIR>/<host>/<service>.log as named by the
+// host and service query parameters. The file holds only that service, so its
+// service filter is dropped.
+func logPath(c *gin.Context, cfg Config, filter *logFilter) (string, error) {
+	host := c.Query("host")
+	if cfg.OutputLayout != layoutPerService {
+		if host != "" {
+			return "", fmt.Errorf("host only selects a file in the %s layout", layoutPerService)
+		}
+		return cfg.OutputFile, nil
+	}
+
+	hosts := hostNames(cfg.HostPrefix, cfg.HostCount)
+	if !contains(hosts, host) {
+		return "", fmt.Errorf("the %s layout needs host set to one of the virtual hosts, e.g. host=%s", layoutPerService, hosts[0])
+	}
+	if len(filter.services) != 1 || !routedNamePattern.MatchString(filter.services[0]) {
+		return "", fmt.Errorf("the %s layout needs a single service, or %s, %s or %s", layoutPerService, accessFile, nginxFile, unroutedFile)
+	}
+	path := filepath.Join(cfg.OutputDir, host, filter.services[0]+".log")
+	filter.services = nil
+	return path, nil
+}
+
+func (f logFilter) match(r LogRecord) bool {
+	if len(f.levels) > 0 && !contains(f.levels, r.LogType) {
+		return false
+	}
+	if len(f.services) > 0 && !contains(f.services, r.Service) {
+		return false
+	}
+	if len(f.formats) > 0 && !contains(f.formats, r.Format) {
+		return false
+	}
+	if !f.from.IsZero() && r.Timestamp.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && r.Timestamp.After(f.to) {
+		return false
+	}
+	return true
+}
+
+// attachContinuation adds a line that belongs to the record before it, such as
+// a stack trace frame, to the record's stack trace.
+func attachContinuation(r *LogRecord, line string) {
+	if r.StackTrace != "" {
+		r.StackTrace += "\n"
+	}
+	r.StackTrace += line
+	r.Raw += "\n" + line
+}
+
+// readLogsBefore returns up to limit records matching filter that start before
+// offset end, oldest first. more reports whether older lines remain unread.
+func readLogsBefore(path string, end int64, limit int, filter logFilter, now time.Time) (records []LogRecord, more bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	// lines that could not be parsed are continuations of the line before
+	// them; reading backwards they come first, so hold on to them
+	var continuation []string
+
+	err = reverseLines(file, end, func(line string, offset int64) bool {
+		r, ok := parseLogLine(line, now)
+		if !ok {
+			continuation = append(continuation, line)
+			return true
+		}
+
+		for i := len(continuation) - 1; i >= 0; i-- {
+			attachContinuation(&r, continuation[i])
+		}
+		continuation = continuation[:0]
+
+		if !filter.match(r) {
+			return true
+		}
+		r.Cursor = strconv.FormatInt(offset, 10)
+		records = append(records, r)
+		if len(records) == limit {
+			more = offset > 0
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// newest first while reading, oldest first in the response
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, more, nil
+}
+
+// followedRecord is a record read by a logFollower along with the offset just
+// past its last line, which is where a reconnecting client resumes.
+type followedRecord struct {
+	LogRecord
+	End int64
+}
+
+// logFollower reads lines appended to a log file, like tail -f. It reopens the
+// file when it is rotated and starts over when it is truncated.
+type logFollower struct {
+	path    string
+	file    *os.File
+	offset  int64
+	partial []byte
+	pending *followedRecord
+	now     func() time.Time
+}
+
+// newLogFollower starts following path at offset, or at the end of the file
+// when offset is negative. An offset past the end means the file was rotated
+// since, so following starts at the beginning of the new file.
+func newLogFollower(path string, offset int64, now func() time.Time) (*logFollower, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	switch {
+	case offset < 0:
+		offset = info.Size()
+	case offset > info.Size():
+		offset = 0
+	}
+
+	return &logFollower{path: path, file: file, offset: offset, now: now}, nil
+}
+
+func (f *logFollower) Close() error {
+	return f.file.Close()
+}
+
+// Poll returns the records written since the last call. A record is held back
+// until the next line starts or the file goes quiet, so any stack trace lines
+// after it are attached first.
+func (f *logFollower) Poll() ([]followedRecord, error) {
+	var records []followedRecord
+
+	read, err := f.readNew(&records)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := f.followRotation(&records)
+	if err != nil {
+		return nil, err
+	}
+	read += n
+
+	if read == 0 && f.pending != nil {
+		records = append(records, *f.pending)
+		f.pending = nil
+	}
+	return records, nil
+}
+
+// followRotation moves on to the new file at the path once the followed one
+// has been rotated away, or starts over when it was truncated in place. It
+// returns how many complete lines it read.
+func (f *logFollower) followRotation(records *[]followedRecord) (int, error) {
+	current, err := f.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(f.path)
+	switch {
+	case err == nil && !os.SameFile(info, current):
+		// the writer may have added lines since the last read and before
+		// rotating, so drain the old file to its end first
+		read, err := f.readNew(records)
+		if err != nil {
+			return 0, err
+		}
+		file, err := os.Open(f.path)
+		if err != nil {
+			return 0, err
+		}
+		f.file.Close()
+		f.file, f.offset, f.partial = file, 0, nil
+		n, err := f.readNew(records)
+		if err != nil {
+			return 0, err
+		}
+		return read + n, nil
+	case err == nil && info.Size() < f.offset:
+		// truncated in place
+		f.offset, f.partial = 0, nil
+	}
+	return 0, nil
+}
+
+// readNew reads from the current offset to the end of the file and returns
+// how many complete lines it found.
+func (f *logFollower) readNew(records *[]followedRecord) (int, error) {
+	if _, err := f.file.Seek(f.offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(f.file)
+	if err != nil {
+		return 0, err
+	}
+	f.offset += int64(len(data))
+
+	data = append(f.partial, data...)
+	start := f.offset - int64(len(data))
+	lines := 0
+
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx == -1 {
+			break
+		}
+		line := string(data[:idx])
+		lineStart := start
+		start += int64(idx) + 1
+		data = data[idx+1:]
+		lines++
+
+		r, ok := parseLogLine(line, f.now())
+		if !ok {
+			if f.pending != nil {
+				attachContinuation(&f.pending.LogRecord, line)
+				f.pending.End = start
+			}
+			continue
+		}
+
+		if f.pending != nil {
+			*records = append(*records, *f.pending)
+		}
+		r.Cursor = strconv.FormatInt(lineStart, 10)
+		f.pending = &followedRecord{LogRecord: r, End: start}
+	}
+
+	f.partial = append([]byte(nil), data...)
+	return lines, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var queryTestNow = time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+
+func appLine(i int) string {
+	return fmt.Sprintf("[%s] INFO [user-service] line %d", queryTestNow.Add(time.Duration(i)*time.Second).Format(time.RFC3339), i)
+}
+
+func appendLines(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, line := range lines {
+		if _, err := file.WriteString(line + "\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadLogsBeforePaging(t *testing.T) {
+	tests := []struct {
+		lines, limit int
+	}{
+		{6, 2},  // the last page ends exactly at offset 0
+		{7, 2},  // the last page is short
+		{3, 10}, // everything on one page
+		{1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d lines by %d", tt.lines, tt.limit), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "service.log")
+			var want []string
+			for i := 0; i < tt.lines; i++ {
+				want = append(want, appLine(i))
+			}
+			appendLines(t, path, want...)
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			end := info.Size()
+			for pages := 0; ; pages++ {
+				if pages > tt.lines {
+					t.Fatal("paging does not end")
+				}
+				records, more, err := readLogsBefore(path, end, tt.limit, logFilter{}, queryTestNow)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(records) > tt.limit {
+					t.Fatalf("page of %d records, limit %d", len(records), tt.limit)
+				}
+
+				page := make([]string, len(records))
+				for i, r := range records {
+					page[i] = r.Raw
+				}
+				got = append(page, got...)
+
+				if !more {
+					if len(records) == 0 || records[0].Cursor != "0" {
+						t.Errorf("last page does not start at offset 0: %v", records)
+					}
+					break
+				}
+				if end, err = strconv.ParseInt(records[0].Cursor, 10, 64); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("paged through %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestReadLogsBeforeAttachesStackTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	appendLines(t, path, appLine(0), appLine(1), "    at a.b(C.java:1)", "    at d.e(F.java:2)", appLine(2))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, more, err := readLogsBefore(path, info.Size(), 10, logFilter{}, queryTestNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if more || len(records) != 3 {
+		t.Fatalf("got %d records, more %v", len(records), more)
+	}
+	if want := "    at a.b(C.java:1)\n    at d.e(F.java:2)"; records[1].StackTrace != want {
+		t.Errorf("stack trace %q, want %q", records[1].StackTrace, want)
+	}
+}
+
+// pollRaw polls until the follower returns nothing and reports the raw lines.
+func pollRaw(t *testing.T, f *logFollower) []string {
+	t.Helper()
+	var raw []string
+	for {
+		records, err := f.Poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) == 0 && f.pending == nil {
+			return raw
+		}
+		for _, r := range records {
+			raw = append(raw, r.Raw)
+		}
+	}
+}
+
+func TestLogFollowerAcrossRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	appendLines(t, path, appLine(0))
+
+	f, err := newLogFollower(path, -1, func() time.Time { return queryTestNow })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	appendLines(t, path, appLine(1))
+	if got := pollRaw(t, f); fmt.Sprint(got) != fmt.Sprint([]string{appLine(1)}) {
+		t.Errorf("before rotation got %q", got)
+	}
+
+	// the writer finishes the old file, then starts a new one
+	appendLines(t, path, appLine(2), "    at a.b(C.java:1)")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, path, appLine(3))
+
+	records, err := f.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Raw != appLine(2)+"\n    at a.b(C.java:1)" {
+		t.Fatalf("rotated file's last record: %v", records)
+	}
+
+	records, err = f.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Raw != appLine(3) || records[0].Cursor != "0" {
+		t.Fatalf("new file's first record: %v", records)
+	}
+	if size := int64(len(appLine(3)) + 1); records[0].End != size {
+		t.Errorf("end %d, want %d", records[0].End, size)
+	}
+}
+
+func TestLogFollowerDrainsRotatedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	appendLines(t, path, appLine(0))
+
+	f, err := newLogFollower(path, 0, func() time.Time { return queryTestNow })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// the first half of a Poll reads the file to its end...
+	var records []followedRecord
+	if _, err := f.readNew(&records); err != nil {
+		t.Fatal(err)
+	}
+	// ...then the writer adds a line and rotates before the rotation check
+	appendLines(t, path, appLine(1))
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, path, appLine(2))
+	if _, err := f.followRotation(&records); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, r := range records {
+		got = append(got, r.Raw)
+	}
+	got = append(got, pollRaw(t, f)...)
+	if want := []string{appLine(0), appLine(1), appLine(2)}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLogFollowerAfterTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	appendLines(t, path, appLine(0), appLine(1))
+
+	f, err := newLogFollower(path, -1, func() time.Time { return queryTestNow })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	pollRaw(t, f)
+	appendLines(t, path, appLine(2))
+	if got := pollRaw(t, f); fmt.Sprint(got) != fmt.Sprint([]string{appLine(2)}) {
+		t.Errorf("after truncation got %q", got)
+	}
+}
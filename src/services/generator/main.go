@@ -2,24 +2,55 @@ package main
 
 import (
 	"log"
+	"os"
 )
 
 
 type App struct {
 	Config
+	generators *GeneratorManager
 }
 
-func NewApp(cfg Config) *App {
-	return &App{Config: cfg}
+func NewApp(cfg Config, generators *GeneratorManager) *App {
+	return &App{Config: cfg, generators: generators}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		if err := runBackfill(os.Args[2:]); err != nil {
+			log.Fatalf("backfill failed: %v", err)
+		}
+		return
+	}
+
 	cfg := LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
 
-	app := NewApp(cfg)
+	generator, err := NewLogGenerator(cfg)
+	if err != nil {
+		log.Fatalf("failed to set up generator: %v", err)
+	}
+	if cfg.ScenarioFile != "" {
+		scenario, err := LoadScenario(cfg.ScenarioFile, cfg.Services)
+		if err != nil {
+			log.Fatalf("failed to load scenario: %v", err)
+		}
+		generator.SetScenario(scenario)
+	}
+	if cfg.ReplayFile != "" {
+		generator.SetReplay(&ReplaySource{
+			Path:    cfg.ReplayFile,
+			Speed:   cfg.ReplaySpeed,
+			Rewrite: cfg.ReplayRewriteTimestamps,
+		})
+	}
+	if err := generator.Start(cfg.RunDuration); err != nil {
+		log.Fatalf("failed to start generator: %v", err)
+	}
 
-	generator := NewLogGenerator(cfg)
-	go generator.Run(0)
+	app := NewApp(cfg, NewGeneratorManager(cfg, generator))
 
 	router := app.setupRouter()
 	log.Println("Starting Gin server on :8000")
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// the instance configured from the environment at startup
+const defaultGeneratorName = "default"
+
+var generatorNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// errSetup marks a configuration that is valid but could not be set up, such
+// as an output file that cannot be opened.
+var errSetup = errors.New("failed to set up generator")
+
+// GeneratorManager holds the named generator instances. Each has its own
+// configuration and output file.
+type GeneratorManager struct {
+	mu         sync.RWMutex
+	base       Config
+	generators map[string]*LogGenerator
+}
+
+func NewGeneratorManager(base Config, generator *LogGenerator) *GeneratorManager {
+	return &GeneratorManager{
+		base:       base,
+		generators: map[string]*LogGenerator{defaultGeneratorName: generator},
+	}
+}
+
+func (m *GeneratorManager) Get(name string) (*LogGenerator, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	lg, ok := m.generators[name]
+	return lg, ok
+}
+
+// NewConfig returns the configuration a new instance starts from: the startup
+// configuration, writing to <name>.log next to the default output file (or
+// under <OUTPUT_DIR>/<name> in the per_service layout) and not to the console.
+func (m *GeneratorManager) NewConfig(name string) Config {
+	cfg := m.base
+	cfg.OutputFile = filepath.Join(filepath.Dir(m.base.OutputFile), name+".log")
+	cfg.OutputDir = filepath.Join(m.base.OutputDir, name)
+	cfg.ConsoleOutput = false
+	cfg.FaultManifestFile = ""
+	cfg.PIIManifestFile = ""
+	cfg.SecurityManifestFile = ""
+	cfg.ScenarioFile = ""
+	cfg.ReplayFile = ""
+	return cfg
+}
+
+// Create adds a named instance. It is idle until started.
+func (m *GeneratorManager) Create(name string, cfg Config) (*LogGenerator, error) {
+	if !generatorNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid generator name %q, use up to 64 letters, digits, - and _", name)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.generators[name]; ok {
+		return nil, fmt.Errorf("generator %q already exists", name)
+	}
+	for other, lg := range m.generators {
+		if lg.Config().OutputFile == cfg.OutputFile {
+			return nil, fmt.Errorf("output file %s is already used by generator %q", cfg.OutputFile, other)
+		}
+		for _, dir := range outputDirs(cfg) {
+			if contains(outputDirs(lg.Config()), dir) {
+				return nil, fmt.Errorf("output directory %s is already used by generator %q", dir, other)
+			}
+		}
+	}
+
+	lg, err := NewLogGenerator(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errSetup, err)
+	}
+	m.generators[name] = lg
+	return lg, nil
+}
+
+// outputDirs lists the directories an instance in the per_service layout
+// writes files into: OUTPUT_DIR itself and one per host.
+func outputDirs(cfg Config) []string {
+	if cfg.OutputLayout != layoutPerService {
+		return nil
+	}
+	dir := filepath.Clean(cfg.OutputDir)
+	dirs := []string{dir}
+	for _, host := range hostNames(cfg.HostPrefix, cfg.HostCount) {
+		dirs = append(dirs, filepath.Join(dir, host))
+	}
+	return dirs
+}
+
+// OutputFile resolves the output_file of a start request. Instances may only
+// write to files directly in the directory of the default output file; a bare
+// name is taken to be in it.
+func (m *GeneratorManager) OutputFile(file string) (string, error) {
+	dir := filepath.Clean(filepath.Dir(m.base.OutputFile))
+	path := file
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+
+	if filepath.Dir(path) != dir || path == dir {
+		return "", fmt.Errorf("output_file must be a file name in %s", dir)
+	}
+	return path, nil
+}
+
+// Statuses reports every instance, ordered by name.
+func (m *GeneratorManager) Statuses() []GeneratorStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.generators))
+	for name := range m.generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statuses := make([]GeneratorStatus, len(names))
+	for i, name := range names {
+		statuses[i] = m.generators[name].Status()
+		statuses[i].Name = name
+	}
+	return statuses
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestManager builds a manager around a test generator as its default
+// instance, and closes every instance it creates when the test ends.
+func newTestManager(t *testing.T, env map[string]string) *GeneratorManager {
+	t.Helper()
+	lg := newTestGenerator(t, env)
+	m := NewGeneratorManager(lg.Config(), lg)
+	t.Cleanup(func() {
+		for name, lg := range m.generators {
+			if name != defaultGeneratorName {
+				lg.output.Close()
+				lg.closeManifests()
+			}
+		}
+	})
+	return m
+}
+
+func TestManagerCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		create  string
+		cfg     func(m *GeneratorManager, cfg Config) Config
+		wantErr bool
+	}{
+		{
+			name:   "new instance",
+			create: "load",
+		},
+		{
+			name:    "existing name",
+			create:  defaultGeneratorName,
+			wantErr: true,
+		},
+		{
+			name:    "invalid name",
+			create:  "../load",
+			wantErr: true,
+		},
+		{
+			name:    "invalid configuration",
+			create:  "load",
+			cfg:     func(m *GeneratorManager, cfg Config) Config { cfg.LogRate = 0; return cfg },
+			wantErr: true,
+		},
+		{
+			name:    "output file of another instance",
+			create:  "load",
+			cfg:     func(m *GeneratorManager, cfg Config) Config { cfg.OutputFile = m.base.OutputFile; return cfg },
+			wantErr: true,
+		},
+		{
+			name:   "per_service instance",
+			env:    map[string]string{"OUTPUT_LAYOUT": "per_service", "HOST_COUNT": "2"},
+			create: "load",
+		},
+		{
+			name:    "per_service instance in a host directory of another",
+			env:     map[string]string{"OUTPUT_LAYOUT": "per_service", "HOST_COUNT": "2"},
+			create:  "host-02",
+			wantErr: true,
+		},
+		{
+			name:    "per_service instance in the directory of another",
+			env:     map[string]string{"OUTPUT_LAYOUT": "per_service", "HOST_COUNT": "2"},
+			create:  "load",
+			cfg:     func(m *GeneratorManager, cfg Config) Config { cfg.OutputDir = m.base.OutputDir; return cfg },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, tt.env)
+			cfg := m.NewConfig(tt.create)
+			if tt.cfg != nil {
+				cfg = tt.cfg(m, cfg)
+			}
+
+			_, err := m.Create(tt.create, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Create() error = %v, want error %v", err, tt.wantErr)
+			}
+			if _, ok := m.Get(tt.create); !ok && !tt.wantErr {
+				t.Errorf("Get(%q) found nothing after Create", tt.create)
+			}
+		})
+	}
+}
+
+func TestManagerRunsInstancesSeparately(t *testing.T) {
+	m := newTestManager(t, runControlEnv)
+
+	names := []string{"load", "soak"}
+	for i, name := range names {
+		cfg := m.NewConfig(name)
+		cfg.LogRate = 10 * (i + 1)
+		if _, err := m.Create(name, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range names {
+		lg, _ := m.Get(name)
+		if err := lg.Start(10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range names {
+		lg, _ := m.Get(name)
+		waitStopped(t, lg)
+	}
+
+	statuses := m.Statuses()
+	if len(statuses) != 3 || statuses[0].Name != defaultGeneratorName || statuses[1].Name != "load" || statuses[2].Name != "soak" {
+		t.Fatalf("statuses = %+v, want default, load and soak", statuses)
+	}
+	if statuses[0].State != StateIdle || statuses[0].LinesEmitted != 0 {
+		t.Errorf("default instance is %s with %d lines, want it left idle", statuses[0].State, statuses[0].LinesEmitted)
+	}
+
+	for _, status := range statuses[1:] {
+		if status.State != StateStopped {
+			t.Errorf("%s: state = %s, want %s", status.Name, status.State, StateStopped)
+		}
+		if status.OutputFile != filepath.Join(filepath.Dir(m.base.OutputFile), status.Name+".log") {
+			t.Errorf("%s: output file = %s", status.Name, status.OutputFile)
+		}
+		data, err := os.ReadFile(status.OutputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := bytes.Count(data, []byte("\n")); int64(lines) != status.LinesEmitted {
+			t.Errorf("%s: file has %d lines, status reports %d", status.Name, lines, status.LinesEmitted)
+		}
+	}
+	// soak runs at twice the rate of load
+	if statuses[2].LinesEmitted < statuses[1].LinesEmitted*3/2 {
+		t.Errorf("soak emitted %d lines, load %d, want about twice as many", statuses[2].LinesEmitted, statuses[1].LinesEmitted)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// manifestWriter appends JSON Lines records describing what the generator
+// deliberately put into its output.
+type manifestWriter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newManifestWriter(path string) (*manifestWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest %s: %w", path, err)
+	}
+	return &manifestWriter{file: file}, nil
+}
+
+func (m *manifestWriter) Write(record any) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		panic("unable to marshal manifest record")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.file.Write(append(data, '\n')); err != nil {
+		log.Printf("failed to write manifest %s: %v", m.file.Name(), err)
+	}
+}
+
+func (m *manifestWriter) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.file.Close()
+}
+
+// closeManifests closes the generator's manifests once nothing more is
+// written to them.
+func (lg *LogGenerator) closeManifests() {
+	if lg.faults != nil {
+		lg.faults.manifest.Close()
+	}
+	if lg.pii != nil {
+		lg.pii.Close()
+	}
+	if lg.security != nil {
+		lg.security.manifest.Close()
+	}
+}
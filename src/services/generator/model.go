@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 type LogEntry struct {
 	Timestamp string `json:"timestamp"`
 	LogType   string `json:"log_type"`
@@ -8,4 +10,63 @@ type LogEntry struct {
 	Message   string `json:"message"`
 	RequestID string `json:"request_id"`
 	Service   string `json:"service"`
+	Host      string `json:"host,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	Event     string `json:"event,omitempty"`
+
+	StackTrace string `json:"stack_trace,omitempty"`
+
+	TraceID      string `json:"trace_id,omitempty"`
+	SpanID       string `json:"span_id,omitempty"`
+	ParentSpanID string `json:"parent_span_id,omitempty"`
+
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// LogRecord is a line read back from the output file, in whatever format it
+// was written. Format-specific values such as HTTP status or PID go in Fields.
+type LogRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Format    string    `json:"format"`
+	LogType   string    `json:"log_type"`
+	Service   string    `json:"service,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Duration  int       `json:"duration,omitempty"`
+	Message   string    `json:"message"`
+
+	StackTrace string `json:"stack_trace,omitempty"`
+
+	TraceID      string `json:"trace_id,omitempty"`
+	SpanID       string `json:"span_id,omitempty"`
+	ParentSpanID string `json:"parent_span_id,omitempty"`
+
+	Fields map[string]string `json:"fields,omitempty"`
+	Raw    string            `json:"raw"`
+
+	// Cursor is the byte offset of the line in the output file
+	Cursor string `json:"cursor"`
+}
+
+// LogPage is the pagination block of GET /logs. NextCursor fetches the page of
+// older lines and is empty once the start of the file is reached.
+type LogPage struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// ConfigUpdate is the body of PUT/PATCH /config. Nil fields are left unchanged
+// by PATCH; PUT requires all of them.
+type ConfigUpdate struct {
+	LogRate         *int           `json:"LOG_RATE"`
+	LogDistribution map[string]int `json:"LOG_DISTRIBUTION"`
+	LogFormat       *string        `json:"LOG_FORMAT"`
+	Services        []string       `json:"SERVICES"`
+	EnableBursts    *bool          `json:"ENABLE_BURSTS"`
+	BurstFrequency  *float64       `json:"BURST_FREQUENCY"`
+	BurstMultiplier *int           `json:"BURST_MULTIPLIER"`
+	BurstDuration   *float64       `json:"BURST_DURATION"`
 }
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var piiKinds = []string{"email", "phone", "credit_card", "jwt", "national_id"}
+
+// the JSON attribute each kind of PII is written under
+var piiAttributes = map[string]string{
+	"email":       "email",
+	"phone":       "phone",
+	"credit_card": "card_number",
+	"jwt":         "auth_token",
+	"national_id": "ssn",
+}
+
+var piiPhrases = map[string][]string{
+	"email":       {"Password reset requested for %s", "Order confirmation sent to %s", "Login attempt for %s"},
+	"phone":       {"Verification SMS sent to %s", "Customer callback scheduled for %s"},
+	"credit_card": {"Charging card %s", "Card %s declined by issuer"},
+	"jwt":         {"Authorization: Bearer %s", "Refreshed session token %s"},
+	"national_id": {"Identity check passed for SSN %s", "Tax form submitted with SSN %s"},
+}
+
+var (
+	piiFirstNames = []string{"james", "maria", "wei", "olivia", "ahmed", "sofia", "liam", "amara", "noah", "yuki"}
+	piiLastNames  = []string{"smith", "garcia", "chen", "johnson", "okafor", "muller", "rossi", "tanaka", "brown", "silva"}
+	// reserved for documentation, so no real mailbox is ever named
+	piiDomains = []string{"example.com", "example.net", "example.org"}
+)
+
+// PIIRecord is one line of the PII manifest. Locations lists where in the line
+// the value was written: "message", "url" or "attributes.<name>".
+type PIIRecord struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Type        string    `json:"type"`
+	Value       string    `json:"value"`
+	Locations   []string  `json:"locations"`
+}
+
+type piiItem struct {
+	Kind  string
+	Value string
+}
+
+// maybePII returns a fake PII value for the current line at PII_RATE, or nil.
+func (lg *LogGenerator) maybePII() *piiItem {
+	if lg.pii == nil || lg.cfg.PIIRate <= 0 || len(lg.cfg.PIITypes) == 0 || lg.rng.Float64() >= lg.cfg.PIIRate {
+		return nil
+	}
+
+	kind := lg.cfg.PIITypes[lg.rng.Intn(len(lg.cfg.PIITypes))]
+	var value string
+	switch kind {
+	case "email":
+		value = lg.fakeEmail()
+	case "phone":
+		value = lg.fakePhone()
+	case "credit_card":
+		value = lg.fakeCardNumber()
+	case "jwt":
+		value = lg.fakeJWT()
+	case "national_id":
+		value = lg.fakeSSN()
+	}
+	return &piiItem{Kind: kind, Value: value}
+}
+
+// recordPII adds an injected value to the manifest.
+func (lg *LogGenerator) recordPII(item *piiItem, locations ...string) {
+	lg.pii.Write(PIIRecord{
+		GeneratedAt: lg.clock.Now(),
+		Type:        item.Kind,
+		Value:       item.Value,
+		Locations:   locations,
+	})
+}
+
+// piiMessage appends a sentence carrying fake PII to message at PII_RATE.
+// With attribute set the caller also writes the value as a JSON attribute.
+func (lg *LogGenerator) piiMessage(message string, attribute bool) (string, *piiItem) {
+	item := lg.maybePII()
+	if item == nil {
+		return message, nil
+	}
+
+	phrases := piiPhrases[item.Kind]
+	message += ": " + fmt.Sprintf(phrases[lg.rng.Intn(len(phrases))], item.Value)
+
+	locations := []string{"message"}
+	if attribute {
+		locations = append(locations, "attributes."+piiAttributes[item.Kind])
+	}
+	lg.recordPII(item, locations...)
+	return message, item
+}
+
+func (lg *LogGenerator) fakeEmail() string {
+	first := piiFirstNames[lg.rng.Intn(len(piiFirstNames))]
+	last := piiLastNames[lg.rng.Intn(len(piiLastNames))]
+	domain := piiDomains[lg.rng.Intn(len(piiDomains))]
+
+	switch lg.rng.Intn(3) {
+	case 0:
+		return fmt.Sprintf("%s.%s@%s", first, last, domain)
+	case 1:
+		return fmt.Sprintf("%s%s%d@%s", first[:1], last, lg.rng.Intn(100), domain)
+	default:
+		return fmt.Sprintf("%s_%s+%s@%s", first, last, lg.pickString([]string{"shop", "news", "work"}), domain)
+	}
+}
+
+// fakePhone uses the numbers set aside for fiction in North America and the UK.
+func (lg *LogGenerator) fakePhone() string {
+	switch lg.rng.Intn(3) {
+	case 0:
+		return fmt.Sprintf("+1-202-555-01%02d", lg.rng.Intn(100))
+	case 1:
+		return fmt.Sprintf("(312) 555-01%02d", lg.rng.Intn(100))
+	default:
+		return fmt.Sprintf("+44 7700 900%03d", lg.rng.Intn(1000))
+	}
+}
+
+// fakeCardNumber returns a Luhn-valid Visa, Mastercard or Amex number, written
+// the ways people paste them.
+func (lg *LogGenerator) fakeCardNumber() string {
+	var prefix string
+	length := 16
+	switch lg.rng.Intn(3) {
+	case 0:
+		prefix = "4"
+	case 1:
+		prefix = fmt.Sprintf("5%d", lg.rng.Intn(5)+1)
+	default:
+		prefix = lg.pickString([]string{"34", "37"})
+		length = 15
+	}
+
+	digits := []byte(prefix)
+	for len(digits) < length-1 {
+		digits = append(digits, byte('0'+lg.rng.Intn(10)))
+	}
+	digits = append(digits, luhnCheckDigit(digits))
+	number := string(digits)
+
+	switch lg.rng.Intn(3) {
+	case 0:
+		return number
+	case 1:
+		return groupDigits(number, length, " ")
+	default:
+		return groupDigits(number, length, "-")
+	}
+}
+
+func luhnCheckDigit(digits []byte) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		// doubled positions count from the check digit, which is not there yet
+		if (len(digits)-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// groupDigits splits a card number the way it is printed: 4-4-4-4, or 4-6-5
+// for Amex.
+func groupDigits(number string, length int, sep string) string {
+	if length == 15 {
+		return number[:4] + sep + number[4:10] + sep + number[10:]
+	}
+	return number[:4] + sep + number[4:8] + sep + number[8:12] + sep + number[12:]
+}
+
+func (lg *LogGenerator) fakeJWT() string {
+	enc := base64.RawURLEncoding
+	now := lg.clock.Now().Unix()
+
+	header := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := enc.EncodeToString([]byte(fmt.Sprintf(`{"sub":"user-%d","email":"%s","iat":%d,"exp":%d}`,
+		lg.rng.Intn(9000)+1000, lg.fakeEmail(), now, now+3600)))
+
+	signature := make([]byte, 32)
+	for i := range signature {
+		signature[i] = byte(lg.rng.Intn(256))
+	}
+	return strings.Join([]string{header, payload, enc.EncodeToString(signature)}, ".")
+}
+
+// fakeSSN returns a well-formed US social security number, avoiding the area
+// numbers that are never issued.
+func (lg *LogGenerator) fakeSSN() string {
+	area := lg.rng.Intn(899) + 1
+	if area == 666 {
+		area = 665
+	}
+	return fmt.Sprintf("%03d-%02d-%04d", area, lg.rng.Intn(99)+1, lg.rng.Intn(9999)+1)
+}
+
+func (lg *LogGenerator) pickString(values []string) string {
+	return values[lg.rng.Intn(len(values))]
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// luhnValid checks a whole card number, check digit included.
+func luhnValid(number string) bool {
+	sum := 0
+	for i := range number {
+		d := int(number[len(number)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func TestLuhnCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   byte
+	}{
+		{"7992739871", '3'},
+		{"424242424242424", '2'},
+		{"555555555555444", '4'},
+		{"37828224631000", '5'},
+		{"000000000000000", '0'},
+	}
+	for _, tt := range tests {
+		if got := luhnCheckDigit([]byte(tt.digits)); got != tt.want {
+			t.Errorf("luhnCheckDigit(%s) = %c, want %c", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestFakePIIShapes(t *testing.T) {
+	lg := newTestGenerator(t, map[string]string{"SEED": "9"})
+
+	tests := []struct {
+		kind    string
+		fake    func() string
+		pattern string
+	}{
+		{"email", lg.fakeEmail, `^[a-z._+0-9]+@example\.(com|net|org)$`},
+		{"phone", lg.fakePhone, `^(\+1-202-555-01\d\d|\(312\) 555-01\d\d|\+44 7700 900\d{3})$`},
+		{"credit_card", lg.fakeCardNumber, `^(4\d{3}|5[1-5]\d\d)([ -]?\d{4}){3}$|^3[47]\d\d[ -]?\d{6}[ -]?\d{5}$`},
+		{"jwt", lg.fakeJWT, `^eyJ[\w-]+\.eyJ[\w-]+\.[\w-]{43}$`},
+		{"national_id", lg.fakeSSN, `^\d{3}-\d{2}-\d{4}$`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			pattern := regexp.MustCompile(tt.pattern)
+			for i := 0; i < 200; i++ {
+				value := tt.fake()
+				if !pattern.MatchString(value) {
+					t.Fatalf("%q does not match %s", value, tt.pattern)
+				}
+
+				switch tt.kind {
+				case "credit_card":
+					if digits := strings.NewReplacer(" ", "", "-", "").Replace(value); !luhnValid(digits) {
+						t.Fatalf("%s fails the Luhn check", value)
+					}
+				case "national_id":
+					if value[:3] == "000" || value[:3] == "666" || value[0] == '9' || value[4:6] == "00" || value[7:] == "0000" {
+						t.Fatalf("%s is never issued", value)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPIIManifestMatchesOutput(t *testing.T) {
+	tests := []struct {
+		format    string
+		locations []string
+	}{
+		{"json", []string{"message", "attributes.<attribute>"}},
+		{"logfmt", []string{"message"}},
+		{"apache", []string{"url"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			manifest := filepath.Join(t.TempDir(), "pii.jsonl")
+			lg := newTestGenerator(t, map[string]string{
+				"SEED":              "6",
+				"FAKE_CLOCK_START":  "2026-09-01T10:00:00Z",
+				"LOG_RATE":          "50",
+				"LOG_FORMAT":        tt.format,
+				"ENABLE_BURSTS":     "false",
+				"PII_RATE":          "1",
+				"PII_MANIFEST_FILE": manifest,
+			})
+			lg.Run(4, nil)
+			lg.output.Close()
+			lg.closeManifests()
+
+			data, err := os.ReadFile(lg.Config().OutputFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+			file, err := os.Open(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			var records []PIIRecord
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				var record PIIRecord
+				if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+					t.Fatal(err)
+				}
+				records = append(records, record)
+			}
+
+			// at a PII_RATE of 1 every line carries exactly one value
+			if len(records) != len(lines) || len(lines) < 200 {
+				t.Fatalf("%d manifest records for %d lines", len(records), len(lines))
+			}
+			kinds := map[string]bool{}
+			for i, record := range records {
+				kinds[record.Type] = true
+				want := strings.ReplaceAll(strings.Join(tt.locations, ","), "<attribute>", piiAttributes[record.Type])
+				if got := strings.Join(record.Locations, ","); got != want {
+					t.Fatalf("record %d locations %s, want %s", i, got, want)
+				}
+				if record.GeneratedAt.Before(engineTestStart) || record.GeneratedAt.After(lg.clock.Now()) {
+					t.Fatalf("record %d generated at %s, outside the run", i, record.GeneratedAt)
+				}
+
+				line, value := lines[i], record.Value
+				if tt.format == "apache" {
+					value = url.QueryEscape(value)
+				}
+				if !strings.Contains(line, value) {
+					t.Fatalf("line %d does not carry its %s %q:\n%s", i, record.Type, value, line)
+				}
+				if tt.format == "json" {
+					var entry LogEntry
+					if err := json.Unmarshal([]byte(line), &entry); err != nil {
+						t.Fatal(err)
+					}
+					if entry.Attributes[piiAttributes[record.Type]] != record.Value || !strings.Contains(entry.Message, record.Value) {
+						t.Fatalf("line %d does not carry %q in its message and attributes: %s", i, record.Value, line)
+					}
+				}
+			}
+			if len(kinds) != len(piiKinds) {
+				t.Errorf("injected %s, want every kind", fmt.Sprint(kinds))
+			}
+		})
+	}
+}
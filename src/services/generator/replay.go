@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// timestampPattern finds the timestamp of one log format. The first submatch
+// is the timestamp itself, which is parsed and re-rendered with layout.
+type timestampPattern struct {
+	regex  *regexp.Regexp
+	layout string
+}
+
+// tried in order, so the anchored prefixes go before the looser JSON and
+// logfmt fields that could also appear inside a message
+var timestampPatterns = []timestampPattern{
+	// apache: 203.0.113.45 - - [24/Oct/2025:11:02:52 +0000] "GET /users HTTP/1.1" ...
+	{regexp.MustCompile(`^\S+ \S+ \S+ \[(\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]`), "02/Jan/2006:15:04:05 -0700"},
+	// nginx: 2025/10/24 11:02:52 [warn] ...
+	{regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) `), "2006/01/02 15:04:05"},
+	// app: [2025-10-24T11:02:52Z] INFO [user-service] ...
+	{regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2}T[^\]]+)\] `), time.RFC3339Nano},
+	// syslog rfc5424: <134>1 2025-10-24T11:02:52.123Z host ...
+	{regexp.MustCompile(`^<\d{1,3}>1 (\S+) `), "2006-01-02T15:04:05.000Z07:00"},
+	// syslog rfc3164: <134>Oct 24 11:02:52 host ...
+	{regexp.MustCompile(`^<\d{1,3}>(\w{3} [ \d]\d \d{2}:\d{2}:\d{2}) `), time.Stamp},
+	// cri: 2025-10-24T11:02:52.123456789Z stdout F ...
+	{regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\S+) (?:stdout|stderr) [FP] `), containerTimeFormat},
+	// json: {"timestamp":"2025-10-24T11:02:52Z",...}
+	{regexp.MustCompile(`"timestamp":"([^"]+)"`), time.RFC3339Nano},
+	// docker json-file: {"log":"...","stream":"stdout","time":"2025-10-24T11:02:52.123456789Z"}
+	{regexp.MustCompile(`"time":"([^"]+)"`), containerTimeFormat},
+	// logfmt: time=2025-10-24T11:02:52Z level=info ...
+	{regexp.MustCompile(`(?:^| )time=(\S+)`), time.RFC3339Nano},
+}
+
+// findTimestamp returns the timestamp of a log line along with the byte range
+// it occupies and the layout needed to write a replacement.
+func findTimestamp(line string) (ts time.Time, start, end int, layout string, ok bool) {
+	for _, p := range timestampPatterns {
+		loc := p.regex.FindStringSubmatchIndex(line)
+		if loc == nil {
+			continue
+		}
+
+		raw := line[loc[2]:loc[3]]
+		layout := p.layout
+		parsed, err := time.Parse(layout, raw)
+		if err != nil {
+			// RFC 3339 timestamps are written with varying precision
+			if parsed, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+				continue
+			}
+			layout = time.RFC3339Nano
+		}
+		if layout == time.RFC3339Nano && !strings.Contains(raw, ".") {
+			layout = time.RFC3339
+		}
+		return parsed, loc[2], loc[3], layout, true
+	}
+	return time.Time{}, 0, 0, "", false
+}
+
+func openReplayFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, file}, nil
+}
+
+// how often a replay waiting for its next line checks whether it was stopped
+const replayPollInterval = 100 * time.Millisecond
+
+// ReplaySource is a recorded log file for the generator to play back instead
+// of generating lines.
+type ReplaySource struct {
+	Path string
+	// Speed divides the original gaps between timestamps; 0 replays as fast
+	// as possible.
+	Speed float64
+	// Rewrite replaces each timestamp with the time the line is written.
+	Rewrite bool
+}
+
+// SetReplay makes Run play back source instead of generating lines. It must be
+// called before Start.
+func (lg *LogGenerator) SetReplay(source *ReplaySource) {
+	lg.replay = source
+}
+
+// Replay writes the lines of the replay source through the generator's output,
+// keeping the original gaps between timestamps divided by the speed. Lines
+// without a timestamp, such as stack trace continuations, follow the line
+// before them immediately. Like a generated run it holds while paused, and
+// ends after duration seconds of unpaused time (never when 0), at the end of
+// the file or once stop is closed.
+func (lg *LogGenerator) Replay(duration float64, stop <-chan struct{}) error {
+	source := lg.replay
+	reader, err := openReplayFile(source.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open replay file: %w", err)
+	}
+	defer reader.Close()
+	defer lg.output.Close()
+
+	fmt.Printf("Replaying %s at speed %gx (rewrite timestamps: %v)\n", source.Path, source.Speed, source.Rewrite)
+
+	var (
+		first time.Time
+		count int
+	)
+	start := lg.clock.Now()
+
+	// halted waits out a pause and reports whether the replay should end
+	halted := func() bool {
+		if !lg.waitWhilePaused(stop) || (duration > 0 && lg.activeSince(start).Seconds() >= duration) {
+			return true
+		}
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
+
+	buf := bufio.NewReader(reader)
+lines:
+	for {
+		line, err := buf.ReadString('\n')
+		if len(line) > 0 {
+			line = strings.TrimRight(line, "\r\n")
+
+			if ts, tsStart, tsEnd, layout, ok := findTimestamp(line); ok {
+				if ts.Year() == 0 {
+					// rfc3164 timestamps have no year, borrow it from the recording
+					year := first.Year()
+					if first.IsZero() {
+						year = lg.clock.Now().Year()
+					}
+					ts = ts.AddDate(year, 0, 0)
+				}
+
+				if first.IsZero() {
+					first = ts
+				}
+
+				if source.Speed > 0 {
+					// time spent paused does not count towards the gaps
+					offset := time.Duration(float64(ts.Sub(first)) / source.Speed)
+					for wait := offset - lg.activeSince(start); wait > 0; wait = offset - lg.activeSince(start) {
+						if halted() {
+							break lines
+						}
+						lg.clock.Sleep(min(wait, replayPollInterval))
+					}
+				}
+
+				if source.Rewrite {
+					now := lg.clock.Now().In(ts.Location())
+					line = line[:tsStart] + now.Format(layout) + line[tsEnd:]
+				}
+			}
+
+			if halted() {
+				break lines
+			}
+
+			lg.logger.Println(line)
+			lg.emitted.Add(1)
+			lg.meter.Add(1)
+			count++
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read replay file: %w", err)
+		}
+	}
+
+	fmt.Printf("Replayed %d log lines from %s\n", count, source.Path)
+	return nil
+}
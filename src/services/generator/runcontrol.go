@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	StateIdle    = "idle"
+	StateRunning = "running"
+	StatePaused  = "paused"
+	StateStopped = "stopped"
+)
+
+// runControl tracks where a generator is in its lifecycle. A run can be
+// started again once it has stopped.
+type runControl struct {
+	mu        sync.Mutex
+	state     string
+	stop      chan struct{}
+	done      chan struct{}
+	resume    chan struct{} // non-nil while paused, closed on resume
+	startedAt time.Time
+	pausedAt  time.Time
+	paused    time.Duration
+}
+
+type GeneratorStatus struct {
+	Name          string     `json:"name"`
+	State         string     `json:"state"`
+	OutputFile    string     `json:"output_file"`
+	LinesEmitted  int64      `json:"lines_emitted"`
+	CurrentRate   float64    `json:"current_rate"`
+	TargetRate    float64    `json:"target_rate"`
+	InBurstMode   bool       `json:"in_burst_mode"`
+	BurstEndsAt   *time.Time `json:"burst_ends_at,omitempty"`
+	Scenario      string     `json:"scenario,omitempty"`
+	ScenarioPhase string     `json:"scenario_phase,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	PausedFor     string     `json:"paused_for,omitempty"`
+}
+
+// Start runs the generator in the background for duration seconds of unpaused
+// time, or until stopped when duration is 0.
+func (lg *LogGenerator) Start(duration float64) error {
+	c := &lg.control
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == StateRunning || c.state == StatePaused {
+		return fmt.Errorf("generator is already %s", c.state)
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	c.state, c.stop, c.done = StateRunning, stop, done
+	c.startedAt, c.paused, c.resume = lg.clock.Now(), 0, nil
+	// a stopped run has already written its held lines and ended its
+	// failures and campaigns, only the counts are left to clear
+	lg.emitted.Store(0)
+	lg.stats.Reset()
+
+	go func() {
+		lg.Run(duration, stop)
+
+		c.mu.Lock()
+		c.state, c.resume = StateStopped, nil
+		c.mu.Unlock()
+		close(done)
+	}()
+	return nil
+}
+
+// Pause holds every worker before its next line until Resume or Stop.
+func (lg *LogGenerator) Pause() error {
+	c := &lg.control
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StateRunning {
+		return fmt.Errorf("generator is %s, not running", c.stateName())
+	}
+	c.state = StatePaused
+	c.resume = make(chan struct{})
+	c.pausedAt = lg.clock.Now()
+	return nil
+}
+
+func (lg *LogGenerator) Resume() error {
+	c := &lg.control
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StatePaused {
+		return fmt.Errorf("generator is %s, not paused", c.stateName())
+	}
+	c.state = StateRunning
+	c.paused += lg.clock.Now().Sub(c.pausedAt)
+	close(c.resume)
+	c.resume = nil
+	return nil
+}
+
+// Stop ends the run and waits for the workers to write their last lines.
+func (lg *LogGenerator) Stop() error {
+	c := &lg.control
+	c.mu.Lock()
+	if c.state != StateRunning && c.state != StatePaused {
+		defer c.mu.Unlock()
+		return fmt.Errorf("generator is %s, not running", c.stateName())
+	}
+	close(c.stop)
+	done := c.done
+	c.mu.Unlock()
+
+	<-done
+	return nil
+}
+
+func (c *runControl) stateName() string {
+	if c.state == "" {
+		return StateIdle
+	}
+	return c.state
+}
+
+// waitWhilePaused blocks while the generator is paused and reports whether the
+// worker should carry on.
+func (lg *LogGenerator) waitWhilePaused(done <-chan struct{}) bool {
+	lg.control.mu.Lock()
+	resume := lg.control.resume
+	lg.control.mu.Unlock()
+
+	if resume == nil {
+		return true
+	}
+	select {
+	case <-resume:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// activeSince is the time since start that the generator was not paused.
+func (lg *LogGenerator) activeSince(start time.Time) time.Duration {
+	c := &lg.control
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := lg.clock.Now()
+	active := now.Sub(start) - c.paused
+	if c.state == StatePaused {
+		active -= now.Sub(c.pausedAt)
+	}
+	return active
+}
+
+func (lg *LogGenerator) Status() GeneratorStatus {
+	lg.mu.RLock()
+	status := GeneratorStatus{
+		OutputFile:  lg.cfg.OutputFile,
+		InBurstMode: lg.InBurstMode,
+	}
+	if lg.InBurstMode {
+		ends := lg.BurstEndTime
+		status.BurstEndsAt = &ends
+	}
+	if lg.scenario != nil {
+		status.Scenario = lg.scenario.Name
+		if lg.scenarioPhase != nil {
+			status.ScenarioPhase = lg.scenarioPhase.Name
+		}
+	}
+	lg.mu.RUnlock()
+
+	c := &lg.control
+	c.mu.Lock()
+	status.State = c.stateName()
+	if !c.startedAt.IsZero() {
+		started := c.startedAt
+		status.StartedAt = &started
+	}
+	paused := c.paused
+	if c.state == StatePaused {
+		paused += lg.clock.Now().Sub(c.pausedAt)
+	}
+	if paused > 0 {
+		status.PausedFor = paused.Round(time.Millisecond).String()
+	}
+	running := c.state == StateRunning
+	c.mu.Unlock()
+
+	status.LinesEmitted = lg.emitted.Load()
+	if running {
+		status.CurrentRate = lg.meter.Rate()
+		status.TargetRate = lg.limiter.Rate()
+	}
+	return status
+}
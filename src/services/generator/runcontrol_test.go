@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var runControlEnv = map[string]string{
+	"SEED":             "7",
+	"FAKE_CLOCK_START": "2026-09-01T10:00:00Z",
+	"LOG_RATE":         "10",
+	"ENABLE_BURSTS":    "false",
+}
+
+// waitStopped waits for the run started last to end on its own.
+func waitStopped(t *testing.T, lg *LogGenerator) {
+	t.Helper()
+	lg.control.mu.Lock()
+	done := lg.control.done
+	lg.control.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("run did not end")
+	}
+}
+
+func TestRunControlTransitions(t *testing.T) {
+	lg := newTestGenerator(t, runControlEnv)
+
+	steps := []struct {
+		name    string
+		action  func() error
+		wantErr bool
+		state   string
+	}{
+		{"pause while idle", lg.Pause, true, StateIdle},
+		{"resume while idle", lg.Resume, true, StateIdle},
+		{"stop while idle", lg.Stop, true, StateIdle},
+		{"start", func() error { return lg.Start(0) }, false, StateRunning},
+		{"start while running", func() error { return lg.Start(0) }, true, StateRunning},
+		{"resume while running", lg.Resume, true, StateRunning},
+		{"pause", lg.Pause, false, StatePaused},
+		{"pause while paused", lg.Pause, true, StatePaused},
+		{"start while paused", func() error { return lg.Start(0) }, true, StatePaused},
+		{"resume", lg.Resume, false, StateRunning},
+		{"pause again", lg.Pause, false, StatePaused},
+		{"stop while paused", lg.Stop, false, StateStopped},
+		{"pause while stopped", lg.Pause, true, StateStopped},
+		{"stop while stopped", lg.Stop, true, StateStopped},
+		{"start again", func() error { return lg.Start(0) }, false, StateRunning},
+		{"stop", lg.Stop, false, StateStopped},
+	}
+	for _, step := range steps {
+		err := step.action()
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: error = %v, want error %v", step.name, err, step.wantErr)
+		}
+		if state := lg.Status().State; state != step.state {
+			t.Fatalf("%s: state = %s, want %s", step.name, state, step.state)
+		}
+	}
+}
+
+func TestPauseHoldsWorkers(t *testing.T) {
+	lg := newTestGenerator(t, runControlEnv)
+	if err := lg.Start(0); err != nil {
+		t.Fatal(err)
+	}
+	defer lg.Stop()
+
+	for lg.Status().LinesEmitted == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := lg.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	// a worker may finish the line it was on when the pause came
+	time.Sleep(20 * time.Millisecond)
+	held := lg.Status().LinesEmitted
+	time.Sleep(20 * time.Millisecond)
+	if emitted := lg.Status().LinesEmitted; emitted != held {
+		t.Fatalf("emitted %d lines while paused", emitted-held)
+	}
+
+	if err := lg.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	for lg.Status().LinesEmitted == held {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRestartStartsFresh(t *testing.T) {
+	lg := newTestGenerator(t, runControlEnv)
+	if _, err := lg.InjectFailure(lg.Config().Services[0], time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := []struct {
+		name     string
+		duration float64
+		lines    int64
+	}{
+		{"first run", 20, 200},
+		{"second run", 5, 50},
+	}
+	for _, run := range runs {
+		if err := lg.Start(run.duration); err != nil {
+			t.Fatal(err)
+		}
+		waitStopped(t, lg)
+
+		status := lg.Status()
+		if status.State != StateStopped {
+			t.Fatalf("%s: state = %s, want %s", run.name, status.State, StateStopped)
+		}
+		// the token bucket starts full, so a run may emit a little more than its rate
+		if status.LinesEmitted < run.lines || status.LinesEmitted > run.lines+run.lines/5 {
+			t.Errorf("%s: emitted %d lines, want about %d", run.name, status.LinesEmitted, run.lines)
+		}
+		if total := lg.Statistics(0).TotalCount; int64(total) != status.LinesEmitted {
+			t.Errorf("%s: statistics count %d lines, want %d", run.name, total, status.LinesEmitted)
+		}
+
+		lg.mu.RLock()
+		active := len(lg.failures)
+		lg.mu.RUnlock()
+		if active != 0 {
+			t.Errorf("%s: %d failures outlived the run", run.name, active)
+		}
+	}
+
+	failures := lg.Failures()
+	if len(failures) != 1 || failures[0].Service != lg.Config().Services[0] {
+		t.Errorf("failures = %+v, want the injected one in the history", failures)
+	}
+}
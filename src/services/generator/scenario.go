@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario is a scripted timeline of traffic phases the generator plays back
+// instead of the steady LOG_RATE and random bursts.
+type Scenario struct {
+	Name   string          `yaml:"name" json:"name"`
+	Loop   bool            `yaml:"loop" json:"loop"`
+	Phases []ScenarioPhase `yaml:"phases" json:"phases"`
+}
+
+type ScenarioPhase struct {
+	Name     string        `yaml:"name" json:"name"`
+	Duration time.Duration `yaml:"duration" json:"duration"`
+
+	// Rate is the logs/second at the start of the phase. When RateTo is set
+	// the rate ramps linearly from Rate to RateTo over the phase, so a
+	// rate_to of 0 ramps down rather than meaning no ramp.
+	Rate   int  `yaml:"rate" json:"rate"`
+	RateTo *int `yaml:"rate_to" json:"rate_to,omitempty"`
+
+	LogDistribution     map[string]int            `yaml:"log_distribution" json:"log_distribution"`
+	ServiceDistribution map[string]map[string]int `yaml:"service_distribution" json:"service_distribution"`
+	Bursts              bool                      `yaml:"bursts" json:"bursts"`
+}
+
+// LoadScenario reads a scenario whose service_distribution may only name
+// services.
+func LoadScenario(path string, services []string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario file: %w", err)
+	}
+
+	var scenario Scenario
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario file: %w", err)
+	}
+
+	if err := scenario.Validate(services); err != nil {
+		return nil, err
+	}
+
+	return &scenario, nil
+}
+
+func (s *Scenario) Validate(services []string) error {
+	if len(s.Phases) == 0 {
+		return fmt.Errorf("scenario %q has no phases", s.Name)
+	}
+
+	for i, phase := range s.Phases {
+		if phase.Name == "" {
+			return fmt.Errorf("phase %d has no name", i)
+		}
+		if phase.Duration <= 0 {
+			return fmt.Errorf("phase %q must have a positive duration", phase.Name)
+		}
+		if phase.Rate <= 0 {
+			return fmt.Errorf("phase %q must have a positive rate", phase.Name)
+		}
+		if phase.RateTo != nil && *phase.RateTo < 0 {
+			return fmt.Errorf("phase %q has a negative rate_to", phase.Name)
+		}
+		if err := validateDistribution(phase.LogDistribution); err != nil {
+			return fmt.Errorf("phase %q: %w", phase.Name, err)
+		}
+		for service, dist := range phase.ServiceDistribution {
+			if !contains(services, service) {
+				return fmt.Errorf("phase %q: service %q is not in SERVICES", phase.Name, service)
+			}
+			if err := validateDistribution(dist); err != nil {
+				return fmt.Errorf("phase %q, service %q: %w", phase.Name, service, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Scenario) TotalDuration() time.Duration {
+	var total time.Duration
+	for _, phase := range s.Phases {
+		total += phase.Duration
+	}
+	return total
+}
+
+// PhaseAt returns the phase active after elapsed time along with the offset
+// into that phase. ok is false once a non-looping scenario has finished.
+func (s *Scenario) PhaseAt(elapsed time.Duration) (phase *ScenarioPhase, offset time.Duration, ok bool) {
+	total := s.TotalDuration()
+	if elapsed >= total {
+		if !s.Loop {
+			return nil, 0, false
+		}
+		elapsed %= total
+	}
+
+	for i := range s.Phases {
+		if elapsed < s.Phases[i].Duration {
+			return &s.Phases[i], elapsed, true
+		}
+		elapsed -= s.Phases[i].Duration
+	}
+
+	return nil, 0, false
+}
+
+func (p *ScenarioPhase) RateAt(offset time.Duration) float64 {
+	if p.RateTo == nil || *p.RateTo == p.Rate {
+		return float64(p.Rate)
+	}
+
+	progress := float64(offset) / float64(p.Duration)
+	if progress > 1 {
+		progress = 1
+	}
+	return float64(p.Rate) + (float64(*p.RateTo)-float64(p.Rate))*progress
+}
+
+// DistributionFor returns the level distribution a service should use during
+// this phase, or nil when the phase does not override it.
+func (p *ScenarioPhase) DistributionFor(service string) map[string]int {
+	if dist, ok := p.ServiceDistribution[service]; ok {
+		return dist
+	}
+	return p.LogDistribution
+}
+
+func validateDistribution(dist map[string]int) error {
+	if dist == nil {
+		return nil
+	}
+
+	total := 0
+	for level, weight := range dist {
+		if !isLogLevel(level) {
+			return fmt.Errorf("unknown log level %q", level)
+		}
+		if weight < 0 {
+			return fmt.Errorf("negative weight for %s", level)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return fmt.Errorf("log distribution weights sum to zero")
+	}
+	return nil
+}
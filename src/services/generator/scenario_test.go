@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var scenarioServices = []string{"user-service", "payment-service"}
+
+func TestLoadScenario(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			yaml: `
+name: incident
+phases:
+  - name: steady
+    duration: 10s
+    rate: 5
+    rate_to: 0
+    log_distribution: {INFO: 90, ERROR: 10}
+    service_distribution:
+      payment-service: {ERROR: 1}
+`,
+		},
+		{
+			name:    "no phases",
+			yaml:    "name: empty\n",
+			wantErr: "has no phases",
+		},
+		{
+			name:    "lowercase level",
+			yaml:    "phases: [{name: p, duration: 1s, rate: 1, log_distribution: {error: 1}}]",
+			wantErr: `unknown log level "error"`,
+		},
+		{
+			name:    "unknown level",
+			yaml:    "phases: [{name: p, duration: 1s, rate: 1, log_distribution: {FATAL: 1}}]",
+			wantErr: `unknown log level "FATAL"`,
+		},
+		{
+			name:    "unknown level for a service",
+			yaml:    "phases: [{name: p, duration: 1s, rate: 1, service_distribution: {user-service: {NOTICE: 1}}}]",
+			wantErr: `unknown log level "NOTICE"`,
+		},
+		{
+			name:    "service not in SERVICES",
+			yaml:    "phases: [{name: p, duration: 1s, rate: 1, service_distribution: {billing-service: {ERROR: 1}}}]",
+			wantErr: `service "billing-service" is not in SERVICES`,
+		},
+		{
+			name:    "weights sum to zero",
+			yaml:    "phases: [{name: p, duration: 1s, rate: 1, log_distribution: {INFO: 0}}]",
+			wantErr: "sum to zero",
+		},
+		{
+			name:    "negative rate_to",
+			yaml:    "phases: [{name: p, duration: 1s, rate: 1, rate_to: -1}]",
+			wantErr: "negative rate_to",
+		},
+		{
+			name:    "no duration",
+			yaml:    "phases: [{name: p, rate: 1}]",
+			wantErr: "positive duration",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeTempFile(t, tt.yaml)
+			_, err := LoadScenario(file.Name(), scenarioServices)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadScenario() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadScenario() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExampleScenarioLoads(t *testing.T) {
+	if _, err := LoadScenario("scenarios/payment-incident.yml", scenarioServices); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPhaseRateAt(t *testing.T) {
+	rate := func(r int) *int { return &r }
+	tests := []struct {
+		name   string
+		rateTo *int
+		offset time.Duration
+		want   float64
+	}{
+		{"no ramp", nil, 5 * time.Second, 10},
+		{"ramp up halfway", rate(20), 5 * time.Second, 15},
+		{"ramp down to zero halfway", rate(0), 5 * time.Second, 5},
+		{"ramp down to zero at the end", rate(0), 10 * time.Second, 0},
+		{"ramp past the end", rate(20), 15 * time.Second, 20},
+		{"ramp to the same rate", rate(10), 5 * time.Second, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phase := ScenarioPhase{Name: "p", Duration: 10 * time.Second, Rate: 10, RateTo: tt.rateTo}
+			if got := phase.RateAt(tt.offset); got != tt.want {
+				t.Errorf("RateAt(%s) = %v, want %v", tt.offset, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPhaseAtLoops(t *testing.T) {
+	scenario := Scenario{Phases: []ScenarioPhase{
+		{Name: "first", Duration: 10 * time.Second, Rate: 1},
+		{Name: "second", Duration: 20 * time.Second, Rate: 1},
+	}}
+
+	tests := []struct {
+		name       string
+		loop       bool
+		elapsed    time.Duration
+		wantPhase  string
+		wantOffset time.Duration
+	}{
+		{"first phase", false, 5 * time.Second, "first", 5 * time.Second},
+		{"second phase", false, 12 * time.Second, "second", 2 * time.Second},
+		{"finished", false, 30 * time.Second, "", 0},
+		{"looped", true, 42 * time.Second, "second", 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scenario.Loop = tt.loop
+			phase, offset, ok := scenario.PhaseAt(tt.elapsed)
+			if !ok {
+				if tt.wantPhase != "" {
+					t.Fatalf("PhaseAt(%s) finished, want phase %s", tt.elapsed, tt.wantPhase)
+				}
+				return
+			}
+			if phase.Name != tt.wantPhase || offset != tt.wantOffset {
+				t.Errorf("PhaseAt(%s) = %s at %s, want %s at %s", tt.elapsed, phase.Name, offset, tt.wantPhase, tt.wantOffset)
+			}
+		})
+	}
+}
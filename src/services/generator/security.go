@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var securityKinds = []string{"credential_stuffing", "path_traversal", "sql_injection", "scanner", "impossible_travel"}
+
+// the patterns that play out in Apache access lines; impossible_travel is
+// written as JSON login lines
+var apacheSecurityKinds = []string{"credential_stuffing", "path_traversal", "sql_injection", "scanner"}
+
+var traversalPaths = []string{
+	"static/../../../../etc/passwd",
+	"download?file=../../../../etc/shadow",
+	"images/..%2f..%2f..%2f..%2fetc%2fpasswd",
+	"api/v1/files?path=....//....//....//etc/hosts",
+	"assets/%2e%2e/%2e%2e/%2e%2e/proc/self/environ",
+	"export?template=..%252f..%252f..%252fwindows%252fwin.ini",
+}
+
+var sqlInjectionPaths = []string{
+	"search?q=%27%20OR%20%271%27%3D%271",
+	"products?id=1%20UNION%20SELECT%20username,password%20FROM%20users--",
+	"users?id=1;DROP%20TABLE%20users--",
+	"orders?sort=(SELECT%20SLEEP(5))",
+	"auth?user=admin%27--&password=x",
+	"products?category=1'OR'1'='1",
+}
+
+var scannerPaths = []string{
+	".env", ".git/config", "wp-login.php", "wp-admin/setup-config.php", "phpmyadmin/",
+	"server-status", "actuator/env", "cgi-bin/test.cgi", "config.json", "backup.zip",
+	"admin/", ".aws/credentials", "vendor/phpunit/phpunit/src/Util/PHP/eval-stdin.php",
+}
+
+var scannerUserAgents = []string{
+	"Mozilla/5.00 (Nikto/2.5.0) (Evasions:None) (Test:000001)",
+	"sqlmap/1.7.2#stable (https://sqlmap.org)",
+	"Mozilla/5.0 (compatible; Nmap Scripting Engine; https://nmap.org/book/nse.html)",
+	"masscan/1.3 (https://github.com/robertdavidgraham/masscan)",
+	"Nuclei - Open-source project (github.com/projectdiscovery/nuclei)",
+}
+
+// what credential stuffing tools announce themselves as
+var stuffingUserAgents = []string{
+	"python-requests/2.31.0",
+	"Go-http-client/1.1",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
+}
+
+// attackers come from the documentation ranges, so no real host is accused
+var attackerNetworks = []string{"192.0.2.", "198.51.100.", "203.0.113."}
+
+type loginLocation struct {
+	Geo string
+	IP  string
+}
+
+// far enough apart that nobody travels between them in minutes
+var loginLocations = []loginLocation{
+	{"New York, US", "198.51.100.17"},
+	{"Tokyo, JP", "203.0.113.88"},
+	{"Sao Paulo, BR", "192.0.2.140"},
+	{"Sydney, AU", "203.0.113.201"},
+	{"Frankfurt, DE", "198.51.100.64"},
+	{"Lagos, NG", "192.0.2.33"},
+}
+
+// SecurityRecord is one line of the security manifest: one simulated attack,
+// written once all of its lines have been.
+type SecurityRecord struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	SourceIPs []string  `json:"source_ips"`
+	UserID    string    `json:"user_id,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Lines     int       `json:"lines"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// securityCampaign is an attack from one IP spread over several access lines.
+type securityCampaign struct {
+	record    SecurityRecord
+	userAgent string
+	remaining int
+}
+
+// pendingLogin is the second login of an impossible travel, due at a time.
+type pendingLogin struct {
+	record   SecurityRecord
+	location loginLocation
+	due      time.Time
+}
+
+type securitySimulator struct {
+	mu        sync.Mutex
+	manifest  *manifestWriter
+	next      int
+	campaigns []*securityCampaign
+	logins    []*pendingLogin
+}
+
+func newSecuritySimulator(path string) (*securitySimulator, error) {
+	manifest, err := newManifestWriter(path)
+	if err != nil {
+		return nil, err
+	}
+	return &securitySimulator{manifest: manifest}, nil
+}
+
+func (s *securitySimulator) newRecord(kind string, now time.Time) SecurityRecord {
+	s.next++
+	return SecurityRecord{ID: fmt.Sprintf("sec-%06d", s.next), Type: kind, FirstSeen: now}
+}
+
+// finish records the attacks still under way, as far as they got.
+func (s *securitySimulator) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.campaigns {
+		c.record.Detail += fmt.Sprintf(", stopped with %d attempts left", c.remaining)
+		s.manifest.Write(c.record)
+	}
+	for _, l := range s.logins {
+		l.record.Detail += ", second login never written"
+		s.manifest.Write(l.record)
+	}
+	s.campaigns, s.logins = nil, nil
+}
+
+// securityKindsFor returns the configured attack types in kinds.
+func (lg *LogGenerator) securityKindsFor(kinds []string) []string {
+	var enabled []string
+	for _, kind := range lg.cfg.SecurityTypes {
+		if contains(kinds, kind) {
+			enabled = append(enabled, kind)
+		}
+	}
+	return enabled
+}
+
+// securityApacheLine returns an attack access line in place of a normal one,
+// continuing a campaign under way or starting a new attack at SECURITY_RATE.
+func (lg *LogGenerator) securityApacheLine() (string, bool) {
+	s := lg.security
+	if s == nil {
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := lg.clock.Now()
+
+	// campaigns share the log with normal traffic rather than owning it
+	if len(s.campaigns) > 0 && lg.rng.Float64() < 0.6 {
+		i := lg.rng.Intn(len(s.campaigns))
+		return lg.campaignLine(s, i, now), true
+	}
+
+	kinds := lg.securityKindsFor(apacheSecurityKinds)
+	if lg.cfg.SecurityRate <= 0 || len(kinds) == 0 || lg.rng.Float64() >= lg.cfg.SecurityRate {
+		return "", false
+	}
+
+	kind := kinds[lg.rng.Intn(len(kinds))]
+	record := s.newRecord(kind, now)
+	ip := lg.attackerIP()
+	record.SourceIPs = []string{ip}
+
+	switch kind {
+	case "credential_stuffing":
+		attempts := lg.rng.Intn(41) + 20
+		record.Detail = fmt.Sprintf("%d login attempts", attempts)
+		s.campaigns = append(s.campaigns, &securityCampaign{
+			record:    record,
+			userAgent: lg.pickString(stuffingUserAgents),
+			remaining: attempts,
+		})
+		return lg.campaignLine(s, len(s.campaigns)-1, now), true
+	case "scanner":
+		probes := lg.rng.Intn(26) + 15
+		record.Detail = fmt.Sprintf("%d probes", probes)
+		s.campaigns = append(s.campaigns, &securityCampaign{
+			record:    record,
+			userAgent: lg.pickString(scannerUserAgents),
+			remaining: probes,
+		})
+		return lg.campaignLine(s, len(s.campaigns)-1, now), true
+	}
+
+	// single requests with a hostile URL
+	var path string
+	var status int
+	if kind == "path_traversal" {
+		path = lg.pickString(traversalPaths)
+		status = []int{400, 403, 404, 404, 200}[lg.rng.Intn(5)]
+	} else {
+		path = lg.pickString(sqlInjectionPaths)
+		status = []int{500, 400, 403, 200}[lg.rng.Intn(4)]
+	}
+	record.LastSeen, record.Lines = now, 1
+	record.Detail = fmt.Sprintf("/%s answered %d", path, status)
+	s.manifest.Write(record)
+
+	userAgent := sampleData["useragent"][lg.rng.Intn(len(sampleData["useragent"]))]
+	return lg.apacheLine(ip, now, "GET", path, "HTTP/1.1", status, lg.rng.Intn(2048)+100, userAgent, lg.attackLatency()), true
+}
+
+// campaignLine writes the next request of campaign i and records the campaign
+// once it is over. The caller holds s.mu.
+func (lg *LogGenerator) campaignLine(s *securitySimulator, i int, now time.Time) string {
+	c := s.campaigns[i]
+	c.remaining--
+	c.record.Lines++
+	c.record.LastSeen = now
+
+	var method, path string
+	var status int
+	if c.record.Type == "credential_stuffing" {
+		method, path = "POST", "auth/login"
+		switch r := lg.rng.Float64(); {
+		case r < 0.03:
+			status = 200
+		case r < 0.1:
+			status = 429
+		default:
+			status = 401
+		}
+	} else {
+		method, path = "GET", lg.pickString(scannerPaths)
+		status = []int{404, 404, 404, 403, 301}[lg.rng.Intn(5)]
+	}
+
+	if c.remaining <= 0 {
+		s.manifest.Write(c.record)
+		s.campaigns = append(s.campaigns[:i], s.campaigns[i+1:]...)
+	}
+	return lg.apacheLine(c.record.SourceIPs[0], now, method, path, "HTTP/1.1", status, lg.rng.Intn(512)+50, c.userAgent, lg.attackLatency())
+}
+
+// securityLoginLine returns a JSON login that is half of an impossible travel:
+// either the second login of one already written, once it is due, or the
+// first of a new one at SECURITY_RATE.
+func (lg *LogGenerator) securityLoginLine(route *entryRoute) (string, bool) {
+	s := lg.security
+	if s == nil {
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := lg.clock.Now()
+	for i, l := range s.logins {
+		if now.Before(l.due) {
+			continue
+		}
+		s.logins = append(s.logins[:i], s.logins[i+1:]...)
+		l.record.SourceIPs = append(l.record.SourceIPs, l.location.IP)
+		l.record.LastSeen, l.record.Lines = now, 2
+		l.record.Detail += fmt.Sprintf(" then %s %s later", l.location.Geo, now.Sub(l.record.FirstSeen).Round(time.Second))
+		s.manifest.Write(l.record)
+		return lg.loginLine(route, l.record.UserID, l.location, now), true
+	}
+
+	if len(lg.securityKindsFor([]string{"impossible_travel"})) == 0 || lg.rng.Float64() >= lg.cfg.SecurityRate {
+		return "", false
+	}
+
+	first := loginLocations[lg.rng.Intn(len(loginLocations))]
+	second := first
+	for second == first {
+		second = loginLocations[lg.rng.Intn(len(loginLocations))]
+	}
+
+	record := s.newRecord("impossible_travel", now)
+	record.UserID = lg.randomActiveUser()
+	record.SourceIPs = []string{first.IP}
+	record.LastSeen, record.Lines = now, 1
+	record.Detail = "logged in from " + first.Geo
+	s.logins = append(s.logins, &pendingLogin{
+		record:   record,
+		location: second,
+		due:      now.Add(time.Duration(lg.rng.Intn(540)+60) * time.Second),
+	})
+	return lg.loginLine(route, record.UserID, first, now), true
+}
+
+func (lg *LogGenerator) loginLine(route *entryRoute, userID string, location loginLocation, now time.Time) string {
+	service := lg.cfg.Services[lg.rng.Intn(len(lg.cfg.Services))]
+	duration := lg.rng.Intn(200) + 20
+	lg.stats.Record(now, INFO, service, duration)
+
+	host := lg.fleetHost()
+	route.add(host, service)
+	data, err := json.Marshal(LogEntry{
+		Timestamp:  now.Format(time.RFC3339),
+		LogType:    INFO,
+		Service:    service,
+		Host:       host,
+		RequestID:  fmt.Sprintf("req-%d-%d", now.Unix(), lg.rng.Intn(9000)+1000),
+		UserID:     userID,
+		Duration:   duration,
+		Message:    "User logged in successfully",
+		SessionID:  "sess-" + lg.randomHex(8),
+		Event:      "login",
+		Attributes: map[string]string{"src_ip": location.IP, "geo": location.Geo},
+	})
+	if err != nil {
+		panic("unable to marshal log entry")
+	}
+	return string(data)
+}
+
+// randomActiveUser picks a user from the session pool, so the attack lands on
+// an account that also has ordinary traffic.
+func (lg *LogGenerator) randomActiveUser() string {
+	lg.sessionMu.Lock()
+	defer lg.sessionMu.Unlock()
+
+	if len(lg.activeUsers) == 0 {
+		return fmt.Sprintf("user-%d", lg.rng.Intn(9000)+1000)
+	}
+	return lg.activeUsers[lg.rng.Intn(len(lg.activeUsers))]
+}
+
+// attackLatency is how long an attack request takes; most are turned away
+// before reaching any real work.
+func (lg *LogGenerator) attackLatency() time.Duration {
+	return time.Duration(lg.sample(Distribution{P50: 8, P99: 250}) * float64(time.Millisecond))
+}
+
+func (lg *LogGenerator) attackerIP() string {
+	return lg.pickString(attackerNetworks) + fmt.Sprint(lg.rng.Intn(254)+1)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runSecurity runs a seeded generator with SECURITY_RATE set and returns its
+// output lines and manifest records.
+func runSecurity(t *testing.T, env map[string]string, seconds float64) ([]string, []SecurityRecord) {
+	t.Helper()
+	manifest := filepath.Join(t.TempDir(), "security.jsonl")
+	env["FAKE_CLOCK_START"] = "2026-09-01T10:00:00Z"
+	env["ENABLE_BURSTS"] = "false"
+	env["SECURITY_MANIFEST_FILE"] = manifest
+
+	lg := newTestGenerator(t, env)
+	lg.Run(seconds, nil)
+	lg.output.Close()
+	lg.closeManifests()
+
+	data, err := os.ReadFile(lg.Config().OutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	file, err := os.Open(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []SecurityRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record SecurityRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.LastSeen.Before(record.FirstSeen) {
+			t.Errorf("%s last seen %s, before it was first seen", record.ID, record.LastSeen)
+		}
+		records = append(records, record)
+	}
+	return lines, records
+}
+
+func TestSecurityCampaignLines(t *testing.T) {
+	lines, records := runSecurity(t, map[string]string{
+		"SEED":          "12",
+		"LOG_RATE":      "50",
+		"LOG_FORMAT":    "apache",
+		"SECURITY_RATE": "0.03",
+	}, 60)
+
+	type request struct{ method, path, status, userAgent string }
+	byIP := map[string][]request{}
+	for _, line := range lines {
+		m := apacheLinePattern.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("not an access line: %s", line)
+		}
+		byIP[m[1]] = append(byIP[m[1]], request{m[3], strings.TrimPrefix(m[4], "/"), m[6], m[9]})
+	}
+
+	// ordinary traffic comes from a few of the documentation addresses too, and
+	// two attacks may draw the same IP; only look at IPs that are one attack's
+	attacks := map[string]int{}
+	for _, record := range records {
+		attacks[record.SourceIPs[0]]++
+	}
+
+	kinds := map[string]int{}
+	for _, record := range records {
+		ip := record.SourceIPs[0]
+		if len(record.SourceIPs) != 1 || !hasPrefix(attackerNetworks, ip) {
+			t.Fatalf("%s came from %v", record.ID, record.SourceIPs)
+		}
+		if attacks[ip] > 1 || contains(sampleData["ip"], ip) {
+			continue
+		}
+		kinds[record.Type]++
+
+		requests := byIP[ip]
+		if len(requests) != record.Lines {
+			t.Fatalf("%s (%s) has %d lines, the manifest says %d", record.ID, record.Type, len(requests), record.Lines)
+		}
+
+		switch record.Type {
+		case "credential_stuffing":
+			rejected := 0
+			for _, r := range requests {
+				if r.method != "POST" || r.path != "auth/login" || !contains([]string{"200", "401", "429"}, r.status) {
+					t.Fatalf("%s: %+v is not a login attempt", record.ID, r)
+				}
+				if r.userAgent != requests[0].userAgent || !contains(stuffingUserAgents, r.userAgent) {
+					t.Fatalf("%s: user agent %q", record.ID, r.userAgent)
+				}
+				if r.status == "401" {
+					rejected++
+				}
+			}
+			if record.Lines < 20 || record.Lines > 60 || rejected < record.Lines/2 {
+				t.Errorf("%s: %d attempts, %d rejected", record.ID, record.Lines, rejected)
+			}
+		case "scanner":
+			for _, r := range requests {
+				if r.method != "GET" || !contains(scannerPaths, r.path) || r.userAgent != requests[0].userAgent || !contains(scannerUserAgents, r.userAgent) {
+					t.Fatalf("%s: %+v is not a scanner probe", record.ID, r)
+				}
+			}
+			if record.Lines < 15 || record.Lines > 40 {
+				t.Errorf("%s: %d probes", record.ID, record.Lines)
+			}
+		case "path_traversal", "sql_injection":
+			paths := traversalPaths
+			if record.Type == "sql_injection" {
+				paths = sqlInjectionPaths
+			}
+			if record.Lines != 1 || !contains(paths, requests[0].path) {
+				t.Errorf("%s: %s requested %+v", record.ID, record.Type, requests)
+			}
+		default:
+			t.Errorf("%s: %s in access lines", record.ID, record.Type)
+		}
+
+		// campaigns still under way when the run stops are recorded as far as they got
+		if strings.Contains(record.Detail, "stopped") {
+			continue
+		}
+		if !record.LastSeen.After(record.FirstSeen) && record.Lines > 1 {
+			t.Errorf("%s: %d lines in no time", record.ID, record.Lines)
+		}
+	}
+
+	for _, kind := range apacheSecurityKinds {
+		if kinds[kind] == 0 {
+			t.Errorf("no %s attack was checked, got %v", kind, kinds)
+		}
+	}
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	lines, records := runSecurity(t, map[string]string{
+		"SEED":           "12",
+		"LOG_RATE":       "4",
+		"LOG_FORMAT":     "json",
+		"SECURITY_RATE":  "0.02",
+		"SECURITY_TYPES": "impossible_travel",
+	}, 600)
+
+	logins := map[string][]LogEntry{}
+	for _, line := range lines {
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Attributes["geo"] != "" {
+			logins[entry.UserID] = append(logins[entry.UserID], entry)
+		}
+	}
+
+	travels := 0
+	for _, record := range records {
+		if record.Type != "impossible_travel" {
+			t.Fatalf("%s is a %s", record.ID, record.Type)
+		}
+		if strings.Contains(record.Detail, "never written") {
+			if record.Lines != 1 || !record.LastSeen.Equal(record.FirstSeen) {
+				t.Errorf("%s: %d lines, last seen %s, for a single login", record.ID, record.Lines, record.LastSeen)
+			}
+			continue
+		}
+		travels++
+
+		if record.Lines != 2 || len(record.SourceIPs) != 2 || record.SourceIPs[0] == record.SourceIPs[1] {
+			t.Fatalf("%s: %d lines from %v", record.ID, record.Lines, record.SourceIPs)
+		}
+		if gap := record.LastSeen.Sub(record.FirstSeen); gap < time.Minute || gap > 10*time.Minute {
+			t.Errorf("%s: logins %s apart", record.ID, gap)
+		}
+
+		// both logins are in the output, for the same user, from each IP in turn
+		for i, at := range []time.Time{record.FirstSeen, record.LastSeen} {
+			found := false
+			for _, entry := range logins[record.UserID] {
+				if entry.Timestamp == at.Format(time.RFC3339) && entry.Attributes["src_ip"] == record.SourceIPs[i] {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%s: no login for %s from %s at %s", record.ID, record.UserID, record.SourceIPs[i], at)
+			}
+		}
+	}
+	if travels == 0 {
+		t.Error("no impossible travel was completed")
+	}
+}
+
+func hasPrefix(prefixes []string, s string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
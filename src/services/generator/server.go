@@ -2,9 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,7 +21,7 @@ func (app *App) setupRouter() *gin.Engine {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -27,52 +32,483 @@ func (app *App) setupRouter() *gin.Engine {
 	})
 
 	router.GET("/logs", app.logsHandler)
+	router.GET("/logs/stream", app.streamLogsHandler)
 	router.GET("/config", app.configHandler)
+	router.PUT("/config", app.updateConfigHandler)
+	router.PATCH("/config", app.updateConfigHandler)
 	router.GET("/statistics", app.getStatistics)
+	router.GET("/formats", app.formatsHandler)
+	router.POST("/templates/reload", app.reloadTemplatesHandler)
+	router.GET("/failures", app.failuresHandler)
+	router.POST("/failures", app.injectFailureHandler)
+
+	router.POST("/generator/start", app.startGeneratorHandler)
+	router.POST("/generator/pause", app.pauseGeneratorHandler)
+	router.POST("/generator/resume", app.resumeGeneratorHandler)
+	router.POST("/generator/stop", app.stopGeneratorHandler)
+	router.GET("/generator/status", app.generatorStatusHandler)
 
 	return router
 }
 
 func (app *App) configHandler(c *gin.Context) {
-	rd := BuildSuccessResponse(http.StatusOK, "Configuration retrieved successfully", app.Config)
+	generator, ok := app.instance(c)
+	if !ok {
+		return
+	}
+
+	rd := BuildSuccessResponse(http.StatusOK, "Configuration retrieved successfully", generator.Config())
+	c.JSON(http.StatusOK, rd)
+}
+
+func (app *App) updateConfigHandler(c *gin.Context) {
+	generator, ok := app.instance(c)
+	if !ok {
+		return
+	}
+
+	var update ConfigUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid configuration payload", err.Error(), nil)
+		c.JSON(http.StatusBadRequest, rd)
+		return
+	}
+
+	if c.Request.Method == http.MethodPut {
+		if missing := update.MissingFields(); len(missing) > 0 {
+			rd := BuildErrorResponse(http.StatusBadRequest, "error", "Missing configuration fields", missing, nil)
+			c.JSON(http.StatusBadRequest, rd)
+			return
+		}
+	}
+
+	cfg := update.ApplyTo(generator.Config())
+	if err := cfg.Validate(); err != nil {
+		rd := BuildErrorResponse(http.StatusUnprocessableEntity, "error", "Invalid configuration", err.Error(), nil)
+		c.JSON(http.StatusUnprocessableEntity, rd)
+		return
+	}
+
+	if err := generator.UpdateConfig(cfg); err != nil {
+		rd := BuildErrorResponse(http.StatusUnprocessableEntity, "error", "Invalid configuration", err.Error(), nil)
+		c.JSON(http.StatusUnprocessableEntity, rd)
+		return
+	}
+
+	rd := BuildSuccessResponse(http.StatusOK, "Configuration updated successfully", generator.Config())
+	// the phase rates and bursts of a scenario take precedence over the config
+	if scenario := generator.Status().Scenario; scenario != "" {
+		if fields := update.ScenarioFields(); len(fields) > 0 {
+			rd.Error = fmt.Sprintf("%s saved, but scenario %q sets its own rate and bursts while it is loaded", strings.Join(fields, " and "), scenario)
+		}
+	}
+	c.JSON(http.StatusOK, rd)
+}
+
+func (app *App) reloadTemplatesHandler(c *gin.Context) {
+	generator, ok := app.instance(c)
+	if !ok {
+		return
+	}
+
+	if err := generator.ReloadMessageTemplates(); err != nil {
+		rd := BuildErrorResponse(http.StatusUnprocessableEntity, "error", "Failed to reload message templates", err.Error(), nil)
+		c.JSON(http.StatusUnprocessableEntity, rd)
+		return
+	}
+
+	rd := BuildSuccessResponse(http.StatusOK, "Message templates reloaded successfully", nil)
+	c.JSON(http.StatusOK, rd)
+}
+
+func (app *App) formatsHandler(c *gin.Context) {
+	rd := BuildSuccessResponse(http.StatusOK, "Formats retrieved successfully", RegisteredFormats())
 	c.JSON(http.StatusOK, rd)
 }
 
+func (app *App) failuresHandler(c *gin.Context) {
+	generator, ok := app.instance(c)
+	if !ok {
+		return
+	}
+
+	rd := BuildSuccessResponse(http.StatusOK, "Failures retrieved successfully", generator.Failures())
+	c.JSON(http.StatusOK, rd)
+}
+
+func (app *App) injectFailureHandler(c *gin.Context) {
+	generator, ok := app.instance(c)
+	if !ok {
+		return
+	}
+
+	var req FailureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid failure request", err.Error(), nil)
+		c.JSON(http.StatusBadRequest, rd)
+		return
+	}
+	if req.Duration == 0 {
+		req.Duration = generator.Config().CascadeFailureDuration
+	}
+
+	failure, err := generator.InjectFailure(req.Service, time.Duration(req.Duration*float64(time.Second)))
+	if err != nil {
+		rd := BuildErrorResponse(http.StatusUnprocessableEntity, "error", "Failed to inject failure", err.Error(), nil)
+		c.JSON(http.StatusUnprocessableEntity, rd)
+		return
+	}
+
+	rd := BuildSuccessResponse(http.StatusCreated, "Failure injected successfully", failure)
+	c.JSON(http.StatusCreated, rd)
+}
+
 func (app *App) getStatistics(c *gin.Context) {
-	stats := analyzeLogFiles(app)
+	generator, ok := app.instance(c)
+	if !ok {
+		return
+	}
+
+	var window time.Duration
+	if windowStr := c.Query("window"); windowStr != "" {
+		var err error
+		window, err = time.ParseDuration(windowStr)
+		if err != nil || window <= 0 {
+			rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid window, expected a duration such as 5m or 1h", windowStr, nil)
+			c.JSON(http.StatusBadRequest, rd)
+			return
+		}
+	}
+
+	stats := generator.Statistics(window)
 	rd := BuildSuccessResponse(http.StatusOK, "Statistics retrieved successfully", stats)
 	c.JSON(http.StatusOK, rd)
 }
 
 func (app *App) logsHandler(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "10")
+	generator, ok := app.instance(c)
+	if !ok {
+		return
+	}
+
+	limitStr := c.DefaultQuery("limit", strconv.Itoa(defaultLogsLimit))
 	limit, _ := strconv.Atoi(limitStr)
 	if limit <= 0 {
-		limit = 10
+		limit = defaultLogsLimit
+	}
+	if limit > maxLogsLimit {
+		limit = maxLogsLimit
 	}
 
-	if _, err := os.Stat(app.Config.OutputFile); os.IsNotExist(err) {
-		rd := BuildErrorResponse(http.StatusNotFound, "error", "Log file not found", err, []LogEntry{})
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid log filter", err.Error(), []LogRecord{})
+		c.JSON(http.StatusBadRequest, rd)
+		return
+	}
+	path, err := logPath(c, generator.Config(), &filter)
+	if err != nil {
+		rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid log file", err.Error(), []LogRecord{})
+		c.JSON(http.StatusBadRequest, rd)
+		return
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		rd := BuildErrorResponse(http.StatusNotFound, "error", "Log file not found", err, []LogRecord{})
 		c.JSON(http.StatusNotFound, rd)
 		return
 	}
+	if err != nil {
+		rd := BuildErrorResponse(http.StatusInternalServerError, "error", "Failed to read logs", err, []LogRecord{})
+		c.JSON(http.StatusInternalServerError, rd)
+		return
+	}
+
+	end := info.Size()
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		cursor, err := strconv.ParseInt(cursorStr, 10, 64)
+		if err != nil || cursor < 0 || cursor > end {
+			// offsets point into the current file, so they go stale once it rotates
+			rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid cursor, the log file may have been rotated since it was issued", cursorStr, []LogRecord{})
+			c.JSON(http.StatusBadRequest, rd)
+			return
+		}
+		end = cursor
+	}
+
+	logs, more, err := readLogsBefore(path, end, limit, filter, generator.clock.Now())
+	if err != nil {
+		rd := BuildErrorResponse(http.StatusInternalServerError, "error", "Failed to read logs", err, []LogRecord{})
+		c.JSON(http.StatusInternalServerError, rd)
+		return
+	}
+	if logs == nil {
+		logs = []LogRecord{}
+	}
+
+	page := &LogPage{Limit: limit, HasMore: more}
+	if more {
+		page.NextCursor = logs[0].Cursor
+	}
+
+	rd := ResponseMessage(http.StatusOK, "success", "", "Logs retrieved successfully", nil, logs, page, nil)
+	c.JSON(http.StatusOK, rd)
+}
+
+// streamLogsHandler sends lines as they are written to the output file as
+// Server-Sent Events. Each event id is the offset to resume from, which
+// browsers send back in Last-Event-ID when they reconnect.
+func (app *App) streamLogsHandler(c *gin.Context) {
+	generator, ok := app.instance(c)
+	if !ok {
+		return
+	}
+
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid log filter", err.Error(), nil)
+		c.JSON(http.StatusBadRequest, rd)
+		return
+	}
+	path, err := logPath(c, generator.Config(), &filter)
+	if err != nil {
+		rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid log file", err.Error(), nil)
+		c.JSON(http.StatusBadRequest, rd)
+		return
+	}
 
-	lines, err := tailLogs(app.Config.OutputFile, limit)
+	offset := int64(-1)
+	resume := c.GetHeader("Last-Event-ID")
+	if resume == "" {
+		resume = c.Query("cursor")
+	}
+	if resume != "" {
+		if offset, err = strconv.ParseInt(resume, 10, 64); err != nil || offset < 0 {
+			rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid cursor", resume, nil)
+			c.JSON(http.StatusBadRequest, rd)
+			return
+		}
+	}
+
+	follower, err := newLogFollower(path, offset, generator.clock.Now)
+	if os.IsNotExist(err) {
+		rd := BuildErrorResponse(http.StatusNotFound, "error", "Log file not found", err, nil)
+		c.JSON(http.StatusNotFound, rd)
+		return
+	}
 	if err != nil {
-		rd := BuildErrorResponse(http.StatusInternalServerError, "error", "Failed to read logs", err, []LogEntry{})
+		rd := BuildErrorResponse(http.StatusInternalServerError, "error", "Failed to read logs", err, nil)
 		c.JSON(http.StatusInternalServerError, rd)
 		return
 	}
+	defer follower.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	poll := time.NewTicker(followPollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-poll.C:
+			records, err := follower.Poll()
+			if err != nil {
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", strconv.Quote(err.Error()))
+				return false
+			}
+			for _, r := range records {
+				if !filter.match(r.LogRecord) {
+					continue
+				}
+				data, err := json.Marshal(r.LogRecord)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", r.End, data); err != nil {
+					return false
+				}
+			}
+			return true
+		}
+	})
+}
+
+// instance finds the generator named by the name query parameter, the default
+// one when it is absent, and answers 404 when there is none.
+func (app *App) instance(c *gin.Context) (*LogGenerator, bool) {
+	name := c.DefaultQuery("name", defaultGeneratorName)
+	generator, ok := app.generators.Get(name)
+	if !ok {
+		rd := BuildErrorResponse(http.StatusNotFound, "error", "Generator not found", name, nil)
+		c.JSON(http.StatusNotFound, rd)
+	}
+	return generator, ok
+}
+
+// StartRequest is the optional body of POST /generator/start. Starting a name
+// that does not exist yet creates it; OutputFile can only be set then.
+type StartRequest struct {
+	Name        string        `json:"name"`
+	OutputFile  string        `json:"output_file"`
+	RunDuration *float64      `json:"run_duration"`
+	Config      *ConfigUpdate `json:"config"`
+}
+
+func (app *App) startGeneratorHandler(c *gin.Context) {
+	var req StartRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid start request", err.Error(), nil)
+			c.JSON(http.StatusBadRequest, rd)
+			return
+		}
+	}
+	if req.Name == "" {
+		req.Name = c.DefaultQuery("name", defaultGeneratorName)
+	}
+
+	duration := 0.0
+	if req.RunDuration != nil {
+		if *req.RunDuration < 0 {
+			rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid start request", "run_duration must not be negative", nil)
+			c.JSON(http.StatusBadRequest, rd)
+			return
+		}
+		duration = *req.RunDuration
+	}
+
+	if req.OutputFile != "" {
+		path, err := app.generators.OutputFile(req.OutputFile)
+		if err != nil {
+			rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid start request", err.Error(), nil)
+			c.JSON(http.StatusBadRequest, rd)
+			return
+		}
+		req.OutputFile = path
+	}
+
+	generator, exists := app.generators.Get(req.Name)
+	if !exists {
+		cfg := app.generators.NewConfig(req.Name)
+		if req.OutputFile != "" {
+			cfg.OutputFile = req.OutputFile
+		}
+		if req.Config != nil {
+			cfg = req.Config.ApplyTo(cfg)
+		}
+
+		var err error
+		if generator, err = app.generators.Create(req.Name, cfg); err != nil {
+			status := http.StatusUnprocessableEntity
+			if errors.Is(err, errSetup) {
+				status = http.StatusBadRequest
+			}
+			rd := BuildErrorResponse(status, "error", "Invalid generator", err.Error(), nil)
+			c.JSON(status, rd)
+			return
+		}
+	} else {
+		if req.OutputFile != "" && req.OutputFile != generator.Config().OutputFile {
+			rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid start request", "output_file can only be set when a generator is created", nil)
+			c.JSON(http.StatusBadRequest, rd)
+			return
+		}
+		if req.Config != nil {
+			cfg := req.Config.ApplyTo(generator.Config())
+			err := cfg.Validate()
+			if err == nil {
+				err = generator.UpdateConfig(cfg)
+			}
+			if err != nil {
+				rd := BuildErrorResponse(http.StatusUnprocessableEntity, "error", "Invalid configuration", err.Error(), nil)
+				c.JSON(http.StatusUnprocessableEntity, rd)
+				return
+			}
+		}
+	}
+
+	if err := generator.Start(duration); err != nil {
+		rd := BuildErrorResponse(http.StatusConflict, "error", "Failed to start generator", err.Error(), nil)
+		c.JSON(http.StatusConflict, rd)
+		return
+	}
+
+	app.respondWithStatus(c, req.Name, generator, "Generator started")
+}
+
+func (app *App) pauseGeneratorHandler(c *gin.Context) {
+	app.controlGenerator(c, (*LogGenerator).Pause, "Generator paused")
+}
+
+func (app *App) resumeGeneratorHandler(c *gin.Context) {
+	app.controlGenerator(c, (*LogGenerator).Resume, "Generator resumed")
+}
+
+func (app *App) stopGeneratorHandler(c *gin.Context) {
+	app.controlGenerator(c, (*LogGenerator).Stop, "Generator stopped")
+}
+
+// controlGenerator applies action to the generator named in the query or in a
+// {"name": ...} body.
+func (app *App) controlGenerator(c *gin.Context, action func(*LogGenerator) error, message string) {
+	var req StartRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			rd := BuildErrorResponse(http.StatusBadRequest, "error", "Invalid request", err.Error(), nil)
+			c.JSON(http.StatusBadRequest, rd)
+			return
+		}
+	}
+	if req.Name == "" {
+		req.Name = c.DefaultQuery("name", defaultGeneratorName)
+	}
+
+	generator, ok := app.generators.Get(req.Name)
+	if !ok {
+		rd := BuildErrorResponse(http.StatusNotFound, "error", "Generator not found", req.Name, nil)
+		c.JSON(http.StatusNotFound, rd)
+		return
+	}
+
+	if err := action(generator); err != nil {
+		rd := BuildErrorResponse(http.StatusConflict, "error", "Invalid generator state", err.Error(), nil)
+		c.JSON(http.StatusConflict, rd)
+		return
+	}
+
+	app.respondWithStatus(c, req.Name, generator, message)
+}
 
-	var logs []LogEntry
-	for _, line := range lines {
-		var entry LogEntry
-		if err := json.Unmarshal([]byte(line), &entry); err != nil {
-			continue
+func (app *App) respondWithStatus(c *gin.Context, name string, generator *LogGenerator, message string) {
+	status := generator.Status()
+	status.Name = name
+	rd := BuildSuccessResponse(http.StatusOK, message, status)
+	c.JSON(http.StatusOK, rd)
+}
+
+// generatorStatusHandler reports one generator when a name is given and all
+// of them otherwise.
+func (app *App) generatorStatusHandler(c *gin.Context) {
+	if name := c.Query("name"); name != "" {
+		generator, ok := app.instance(c)
+		if !ok {
+			return
 		}
-		logs = append(logs, entry)
+		app.respondWithStatus(c, name, generator, "Generator status retrieved successfully")
+		return
 	}
 
-	rd := BuildSuccessResponse(http.StatusOK, "Logs retrieved successfully", logs)
+	rd := BuildSuccessResponse(http.StatusOK, "Generator status retrieved successfully", app.generators.Statuses())
 	c.JSON(http.StatusOK, rd)
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const fullConfigUpdate = `{
+	"LOG_RATE": 25,
+	"LOG_DISTRIBUTION": {"INFO": 80, "ERROR": 20},
+	"LOG_FORMAT": "json",
+	"SERVICES": ["user-service", "payment-service"],
+	"ENABLE_BURSTS": false,
+	"BURST_FREQUENCY": 0.1,
+	"BURST_MULTIPLIER": 3,
+	"BURST_DURATION": 2
+}`
+
+func TestUpdateConfigHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		method   string
+		query    string
+		body     string
+		scenario bool
+		status   int
+		check    func(t *testing.T, before, after Config)
+		wantNote bool
+	}{
+		{
+			name:   "full replace",
+			method: http.MethodPut,
+			body:   fullConfigUpdate,
+			status: http.StatusOK,
+			check: func(t *testing.T, before, after Config) {
+				if after.LogRate != 25 || after.LogFormat != "json" || len(after.Services) != 2 || after.EnableBursts {
+					t.Errorf("config = %+v, want the PUT body applied", after)
+				}
+			},
+		},
+		{
+			name:   "replace with fields missing",
+			method: http.MethodPut,
+			body:   `{"LOG_RATE": 25}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "replace with an invalid value",
+			method: http.MethodPut,
+			body:   strings.Replace(fullConfigUpdate, `"LOG_RATE": 25`, `"LOG_RATE": 0`, 1),
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "malformed body",
+			method: http.MethodPut,
+			body:   `{"LOG_RATE":`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "partial update",
+			method: http.MethodPatch,
+			body:   `{"LOG_RATE": 25}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, before, after Config) {
+				if after.LogRate != 25 {
+					t.Errorf("LOG_RATE = %d, want 25", after.LogRate)
+				}
+				if after.LogFormat != before.LogFormat || len(after.Services) != len(before.Services) || after.EnableBursts != before.EnableBursts {
+					t.Errorf("PATCH changed fields it did not set: %+v", after)
+				}
+			},
+		},
+		{
+			name:   "partial update with a lowercase level",
+			method: http.MethodPatch,
+			body:   `{"LOG_DISTRIBUTION": {"info": 9, "error": 1}}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, before, after Config) {
+				if after.LogDistribution["INFO"] != 9 || after.LogDistribution["ERROR"] != 1 || len(after.LogDistribution) != 2 {
+					t.Errorf("LOG_DISTRIBUTION = %v, want the levels upper-cased", after.LogDistribution)
+				}
+			},
+		},
+		{
+			name:   "partial update with an unknown level",
+			method: http.MethodPatch,
+			body:   `{"LOG_DISTRIBUTION": {"fatal": 1}}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "partial update with an unknown format",
+			method: http.MethodPatch,
+			body:   `{"LOG_FORMAT": "xml"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "unknown instance",
+			method: http.MethodPatch,
+			query:  "?name=missing",
+			body:   `{"LOG_RATE": 25}`,
+			status: http.StatusNotFound,
+		},
+		{
+			name:     "rate while a scenario is loaded",
+			method:   http.MethodPatch,
+			body:     `{"LOG_RATE": 25}`,
+			scenario: true,
+			status:   http.StatusOK,
+			wantNote: true,
+		},
+		{
+			name:     "distribution while a scenario is loaded",
+			method:   http.MethodPatch,
+			body:     `{"LOG_DISTRIBUTION": {"INFO": 1}}`,
+			scenario: true,
+			status:   http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lg := newTestGenerator(t, nil)
+			if tt.scenario {
+				lg.SetScenario(&Scenario{Name: "incident", Phases: []ScenarioPhase{{Name: "steady", Duration: time.Minute, Rate: 5}}})
+			}
+			before := lg.Config()
+			router := NewApp(before, NewGeneratorManager(before, lg)).setupRouter()
+
+			req := httptest.NewRequest(tt.method, "/config"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			var res struct {
+				Error any    `json:"error"`
+				Data  Config `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if tt.status != http.StatusOK {
+				if lg.Config().LogRate != before.LogRate {
+					t.Errorf("a rejected update changed LOG_RATE to %d", lg.Config().LogRate)
+				}
+				return
+			}
+
+			if tt.check != nil {
+				tt.check(t, before, res.Data)
+			}
+			if (res.Error != nil) != tt.wantNote {
+				t.Errorf("error = %v, want a note about the scenario %v", res.Error, tt.wantNote)
+			}
+		})
+	}
+}
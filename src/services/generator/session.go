@@ -1,74 +1,103 @@
 package main
 
 import (
-	"math/rand"
+	"fmt"
 	"time"
 )
 
 type UserSession struct {
+	SessionID  string
+	UserID     string
 	State      string
 	LastUpdate time.Time
 }
 
-func (lg *LogGenerator) updateUserSession(user_id string) {
-	states := []string{
-		"login", "browse", "search", "view_item", "add_to_cart", "checkout", "purchase", "logout",
+// nextSessionEvent advances one user from the active pool a step along their
+// journey. It returns the session, the level to log at (a state's own level
+// wins over the one passed in) and the message for that step.
+func (lg *LogGenerator) nextSessionEvent(log_type, service string) (UserSession, string, string) {
+	session := lg.advanceUserSession()
+
+	if level, ok := lg.journey.Levels[session.State]; ok {
+		log_type = level
 	}
 
-	if _, exist := lg.userSessions[user_id]; !exist {
-		// setup a new user session
-		lg.userSessions[user_id] = UserSession{
-			State:      "login",
-			LastUpdate: time.Now(),
-		}
-		return
+	// a failure in this service or one it depends on takes over the line
+	if level, message, ok := lg.cascadeLine(service); ok {
+		return session, level, message
 	}
 
-	user_state := lg.userSessions[user_id].State
-	var currentIdx int
-	for i := range states {
-		if states[i] == user_state {
-			currentIdx = i
-			break
+	return session, log_type, lg.createMessageFromPattern(log_type, service, session)
+}
+
+func (lg *LogGenerator) advanceUserSession() UserSession {
+	lg.sessionMu.Lock()
+	defer lg.sessionMu.Unlock()
+
+	now := lg.clock.Now()
+
+	//drop sessions that went quiet so the pool keeps turning over
+	for i := 0; i < len(lg.activeUsers); {
+		uid := lg.activeUsers[i]
+		if now.Sub(lg.userSessions[uid].LastUpdate) > 5*time.Minute {
+			lg.endUserSession(i)
+			continue
 		}
+		i++
 	}
 
-	next_idx := (currentIdx + 1) % len(states)
-	lg.userSessions[user_id] = UserSession{
-		State:      states[next_idx],
-		LastUpdate: time.Now(),
+	poolSize := lg.cfg.ActiveUsers
+	if poolSize <= 0 {
+		poolSize = 1
 	}
 
-	//cleanup if more than 100 sessions
-	if len(lg.userSessions) > 100 {
-		current_time := time.Now()
-
-		for uid, session := range lg.userSessions {
-			if current_time.Sub(session.LastUpdate) > 5*time.Minute {
-				delete(lg.userSessions, uid)
-			}
+	if len(lg.activeUsers) < poolSize {
+		// setup a new user session
+		session := UserSession{
+			SessionID:  "sess-" + lg.randomHex(8),
+			UserID:     fmt.Sprintf("user-%d", lg.rng.Intn(9000)+1000),
+			State:      lg.journey.Initial,
+			LastUpdate: now,
+		}
+		if _, taken := lg.userSessions[session.UserID]; !taken {
+			lg.userSessions[session.UserID] = session
+			lg.activeUsers = append(lg.activeUsers, session.UserID)
+			return session
 		}
 	}
+
+	idx := lg.rng.Intn(len(lg.activeUsers))
+	session := lg.userSessions[lg.activeUsers[idx]]
+
+	next, ok := lg.journey.Next(session.State, lg.rng.Float64())
+	if !ok {
+		// the previous step ended the journey, the user starts a new session
+		session.SessionID = "sess-" + lg.randomHex(8)
+		next = lg.journey.Initial
+	}
+
+	session.State = next
+	session.LastUpdate = now
+	lg.userSessions[session.UserID] = session
+
+	return session
 }
 
-func (lg *LogGenerator) createMessageFromPattern(log_type, user_id string) string {
-	var state string
-	if _, exists := lg.userSessions[user_id]; exists {
-		state = lg.userSessions[user_id].State
-		sessionMessages := map[string]string{
-			"login":       "User logged in successfully",
-			"browse":      "User browsing product catalog",
-			"search":      "User performed search query",
-			"view_item":   "User viewing product details",
-			"add_to_cart": "User added item to cart",
-			"checkout":    "User initiated checkout process",
-			"purchase":    "User completed purchase",
-			"logout":      "User logged out",
-		}
+func (lg *LogGenerator) endUserSession(idx int) {
+	delete(lg.userSessions, lg.activeUsers[idx])
+	lg.activeUsers = append(lg.activeUsers[:idx], lg.activeUsers[idx+1:]...)
+}
 
-		if msg, ok := sessionMessages[state]; ok {
-			return msg
-		}
+func (lg *LogGenerator) createMessageFromPattern(log_type, service string, session UserSession) string {
+	// templates from MESSAGE_TEMPLATES_FILE replace the built-in messages
+	if message, ok := lg.templateMessage(log_type, service, session); ok {
+		return message
+	}
+
+	// journey steps describe what the user did; warnings and errors drawn from
+	// the distribution describe the system instead
+	if _, stateLevel := lg.journey.Levels[session.State]; stateLevel || log_type == INFO {
+		return lg.journey.Message(session.State)
 	}
 
 	messages := map[string][]string{
@@ -103,7 +132,7 @@ func (lg *LogGenerator) createMessageFromPattern(log_type, user_id string) strin
 	}
 
 	if msgs, ok := messages[log_type]; ok {
-		return msgs[rand.Intn(len(msgs))]
+		return msgs[lg.rng.Intn(len(msgs))]
 	}
 
 	return "Sample log message for " + log_type
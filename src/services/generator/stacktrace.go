@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var stackTraceStyles = []string{"java", "python", "go"}
+
+var stackFrames = map[string][]string{
+	"component": {"Controller", "Service", "Repository", "Client", "Handler", "Processor"},
+	"method":    {"handle", "process", "execute", "validate", "save", "fetch", "charge", "lookup"},
+}
+
+var javaExceptions = []string{
+	`java.lang.NullPointerException: Cannot invoke "String.length()" because "value" is null`,
+	"java.lang.IllegalStateException: Connection pool exhausted",
+	"java.net.SocketTimeoutException: Read timed out",
+	"java.sql.SQLTransientConnectionException: Connection is not available, request timed out after 30000ms",
+	"java.lang.OutOfMemoryError: Java heap space",
+}
+
+var pythonExceptions = []string{
+	"KeyError: 'user_id'",
+	"TypeError: 'NoneType' object is not subscriptable",
+	"ConnectionRefusedError: [Errno 111] Connection refused",
+	"TimeoutError: timed out waiting for response",
+	"ValueError: invalid literal for int() with base 10: ''",
+}
+
+var goPanics = []string{
+	"runtime error: invalid memory address or nil pointer dereference",
+	"runtime error: index out of range [3] with length 3",
+	"assignment to entry in nil map",
+	"runtime error: slice bounds out of range [:12] with capacity 8",
+}
+
+// maybeStackTrace returns a multi-line stack trace for ERROR and CRITICAL
+// events at the configured probability, or "" when none should be attached.
+func (lg *LogGenerator) maybeStackTrace(level, service string) string {
+	if level != ERROR && level != CRITICAL {
+		return ""
+	}
+	if lg.cfg.StackTraceProbability <= 0 || lg.rng.Float64() >= lg.cfg.StackTraceProbability {
+		return ""
+	}
+
+	styles := lg.cfg.StackTraceStyles
+	if len(styles) == 0 {
+		styles = stackTraceStyles
+	}
+
+	depth := lg.cfg.StackTraceDepth
+	if depth <= 0 {
+		depth = 1
+	}
+
+	switch styles[lg.rng.Intn(len(styles))] {
+	case "python":
+		return lg.pythonTraceback(service, depth)
+	case "go":
+		return lg.goPanic(service, depth)
+	default:
+		return lg.javaStackTrace(service, depth)
+	}
+}
+
+// an exception line followed by "\tat com.example.<pkg>.<Class>.<method>(<File>.java:<line>)" frames
+func (lg *LogGenerator) javaStackTrace(service string, depth int) string {
+	pkg := servicePackage(service)
+	class := strings.ToUpper(pkg[:1]) + pkg[1:]
+
+	lines := []string{javaExceptions[lg.rng.Intn(len(javaExceptions))]}
+	for i := 0; i < depth; i++ {
+		component := lg.pickFrame("component")
+		lines = append(lines, fmt.Sprintf("\tat com.example.%s.%s%s.%s(%s%s.java:%d)",
+			pkg, class, component, lg.pickFrame("method"), class, component, lg.rng.Intn(400)+10))
+	}
+	lines = append(lines, fmt.Sprintf("\t... %d more", lg.rng.Intn(40)+5))
+
+	return strings.Join(lines, "\n")
+}
+
+// "Traceback (most recent call last):", File/code line pairs, then the exception
+func (lg *LogGenerator) pythonTraceback(service string, depth int) string {
+	pkg := servicePackage(service)
+
+	lines := []string{"Traceback (most recent call last):"}
+	for i := 0; i < depth; i++ {
+		method := lg.pickFrame("method")
+		module := strings.ToLower(lg.pickFrame("component"))
+		lines = append(lines,
+			fmt.Sprintf(`  File "/app/%s/%s.py", line %d, in %s`, pkg, module, lg.rng.Intn(400)+10, method),
+			fmt.Sprintf("    result = self.%s(request)", lg.pickFrame("method")))
+	}
+	lines = append(lines, pythonExceptions[lg.rng.Intn(len(pythonExceptions))])
+
+	return strings.Join(lines, "\n")
+}
+
+// "panic: ...", the goroutine header, then function/file line pairs
+func (lg *LogGenerator) goPanic(service string, depth int) string {
+	pkg := servicePackage(service)
+
+	lines := []string{
+		"panic: " + goPanics[lg.rng.Intn(len(goPanics))],
+		"",
+		fmt.Sprintf("goroutine %d [running]:", lg.rng.Intn(500)+1),
+	}
+	for i := 0; i < depth; i++ {
+		component := lg.pickFrame("component")
+		lines = append(lines,
+			fmt.Sprintf("%s.(*%s).%s(0xc%09x)", pkg, component, lg.pickFrame("method"), lg.rng.Intn(1<<30)),
+			fmt.Sprintf("\t/app/%s/%s.go:%d +0x%x", pkg, strings.ToLower(component), lg.rng.Intn(400)+10, lg.rng.Intn(0x200)))
+	}
+	lines = append(lines, "exit status 2")
+
+	return strings.Join(lines, "\n")
+}
+
+func (lg *LogGenerator) pickFrame(kind string) string {
+	frames := stackFrames[kind]
+	return frames[lg.rng.Intn(len(frames))]
+}
+
+// servicePackage turns "payment-service" into "payment".
+func servicePackage(service string) string {
+	pkg := strings.TrimSuffix(service, "-service")
+	pkg = strings.ReplaceAll(pkg, "-", "")
+	if pkg == "" {
+		return "app"
+	}
+	return pkg
+}
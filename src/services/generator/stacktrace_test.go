@@ -0,0 +1,121 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStackTraceShape(t *testing.T) {
+	const depth = 3
+	tests := []struct {
+		style string
+		// patterns for the lines before the frames, each frame's lines, and after
+		head, frame, tail []string
+		// the exception line, when it opens or closes the trace
+		first, last []string
+	}{
+		{
+			style: "java",
+			frame: []string{`^\tat com\.example\.payment\.Payment[A-Z]\w+\.[a-z]\w+\(Payment[A-Z]\w+\.java:\d+\)$`},
+			tail:  []string{`^\t\.\.\. \d+ more$`},
+			first: javaExceptions,
+		},
+		{
+			style: "python",
+			head:  []string{`^Traceback \(most recent call last\):$`},
+			frame: []string{`^  File "/app/payment/[a-z]+\.py", line \d+, in [a-z]+$`, `^    result = self\.[a-z]+\(request\)$`},
+			last:  pythonExceptions,
+		},
+		{
+			style: "go",
+			head:  []string{`^panic: .+$`, `^$`, `^goroutine \d+ \[running\]:$`},
+			frame: []string{`^payment\.\(\*[A-Z]\w+\)\.[a-z]+\(0xc[0-9a-f]{9}\)$`, `^\t/app/payment/[a-z]+\.go:\d+ \+0x[0-9a-f]+$`},
+			tail:  []string{`^exit status 2$`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			lg := newTestGenerator(t, map[string]string{
+				"SEED":                    "11",
+				"STACK_TRACE_PROBABILITY": "1",
+				"STACK_TRACE_DEPTH":       "3",
+				"STACK_TRACE_STYLES":      tt.style,
+			})
+
+			var patterns []string
+			patterns = append(patterns, tt.head...)
+			for i := 0; i < depth; i++ {
+				patterns = append(patterns, tt.frame...)
+			}
+			patterns = append(patterns, tt.tail...)
+
+			for i := 0; i < 20; i++ {
+				trace := lg.maybeStackTrace(ERROR, "payment-service")
+				lines := strings.Split(trace, "\n")
+
+				body := lines
+				if tt.first != nil {
+					if !contains(tt.first, lines[0]) {
+						t.Fatalf("trace starts with %q", lines[0])
+					}
+					body = body[1:]
+				}
+				if tt.last != nil {
+					if !contains(tt.last, lines[len(lines)-1]) {
+						t.Fatalf("trace ends with %q", lines[len(lines)-1])
+					}
+					body = body[:len(body)-1]
+				}
+
+				if len(body) != len(patterns) {
+					t.Fatalf("trace has %d lines around its exception, want %d:\n%s", len(body), len(patterns), trace)
+				}
+				for j, pattern := range patterns {
+					if !regexp.MustCompile(pattern).MatchString(body[j]) {
+						t.Fatalf("line %q does not match %s:\n%s", body[j], pattern, trace)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMaybeStackTrace(t *testing.T) {
+	tests := []struct {
+		name        string
+		probability string
+		level       string
+		want        bool
+	}{
+		{"error", "1", ERROR, true},
+		{"critical", "1", CRITICAL, true},
+		{"warning", "1", WARNING, false},
+		{"info", "1", INFO, false},
+		{"disabled", "0", ERROR, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lg := newTestGenerator(t, map[string]string{"SEED": "1", "STACK_TRACE_PROBABILITY": tt.probability})
+			if got := lg.maybeStackTrace(tt.level, "user-service") != ""; got != tt.want {
+				t.Errorf("maybeStackTrace(%s) gave a trace %v, want %v", tt.level, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServicePackage(t *testing.T) {
+	tests := map[string]string{
+		"payment-service":      "payment",
+		"user-profile-service": "userprofile",
+		"checkout":             "checkout",
+		"-service":             "app",
+	}
+	for service, want := range tests {
+		if got := servicePackage(service); got != want {
+			t.Errorf("servicePackage(%q) = %q, want %q", service, got, want)
+		}
+	}
+}
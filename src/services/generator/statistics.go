@@ -1,22 +1,30 @@
 package main
 
 import (
-	"encoding/json"
-	"os"
-	"strings"
+	"sort"
+	"sync"
 	"time"
 )
 
+// the most error sequences and anomalies kept in memory
+const maxStatsEvents = 1000
+
 type ErrorSequences []ErrorSequence
 type Anomalys []Anomaly
 
 type Statistics struct {
+	Window            string             `json:"window"`
+	TotalCount        int                `json:"totalCount"`
 	LogTypeCounts     map[string]int     `json:"logTypeCounts"`
 	ServiceDurations  map[string]float64 `json:"serviceDurations"`
 	ServiceCallCounts map[string]int     `json:"serviceCallCounts"`
-	ErrorSequences    ErrorSequences     `json:"errorSequences"`
-	AnomalyDetections Anomalys           `json:"anomalyDetections"`
-	UpdatedAt         time.Time          `json:"updatedAt"`
+
+	ServiceLatencyPercentiles map[string]LatencyPercentiles `json:"serviceLatencyPercentiles"`
+	ServiceBaselines          map[string]Baseline           `json:"serviceBaselines"`
+
+	ErrorSequences    ErrorSequences `json:"errorSequences"`
+	AnomalyDetections Anomalys       `json:"anomalyDetections"`
+	UpdatedAt         time.Time      `json:"updatedAt"`
 }
 
 type ErrorSequence struct {
@@ -32,113 +40,229 @@ type Anomaly struct {
 	MetricName string    `json:"metricName"`
 	Value      float64   `json:"value"`
 	Threshold  float64   `json:"threshold"`
+	Baseline   float64   `json:"baseline"`
+	ZScore     float64   `json:"zScore"`
 }
 
-func analyzeLogFiles(cfg *App) Statistics {
-	stats := Statistics{
-		LogTypeCounts:     make(map[string]int),
-		ServiceDurations:  make(map[string]float64),
-		ServiceCallCounts: make(map[string]int),
-		UpdatedAt:         time.Now(),
+// statsBucket aggregates everything emitted during one bucket-width slice of time.
+type statsBucket struct {
+	start                time.Time
+	total                int
+	logTypeCounts        map[string]int
+	serviceCalls         map[string]int
+	serviceDurationSum   map[string]float64
+	serviceDurationCount map[string]int
+	serviceLatency       map[string]*quantileSketch
+}
+
+// StatsCollector keeps rolling aggregates of the lines the generator emits in
+// a ring of time buckets, so statistics never need to re-read the output file.
+type StatsCollector struct {
+	mu          sync.Mutex
+	clock       Clock
+	bucketWidth time.Duration
+	retention   time.Duration
+	buckets     []statsBucket
+
+	errorRuns map[string]*ErrorSequence
+	sequences ErrorSequences
+	burstMin  int
+	burstGap  time.Duration
+
+	baselines  map[string]*ewmaBaseline
+	anomalies  Anomalys
+	ewmaAlpha  float64
+	warmup     int
+	zThreshold float64
+}
+
+func NewStatsCollector(clock Clock, cfg Config) *StatsCollector {
+	bucketWidth := time.Duration(cfg.StatsBucketSeconds) * time.Second
+	if bucketWidth <= 0 {
+		bucketWidth = 10 * time.Second
+	}
+	retention := time.Duration(cfg.StatsRetention) * time.Second
+	if retention < bucketWidth {
+		retention = bucketWidth
 	}
 
-	content, err := os.ReadFile(cfg.Config.OutputFile)
-	if err != nil {
-		return stats
+	return &StatsCollector{
+		clock:       clock,
+		bucketWidth: bucketWidth,
+		retention:   retention,
+		buckets:     make([]statsBucket, int(retention/bucketWidth)),
+
+		errorRuns: make(map[string]*ErrorSequence),
+		burstMin:  cfg.ErrorBurstMin,
+		burstGap:  time.Duration(cfg.ErrorBurstGap * float64(time.Second)),
+
+		baselines:  make(map[string]*ewmaBaseline),
+		ewmaAlpha:  cfg.AnomalyEWMAAlpha,
+		warmup:     cfg.AnomalyWarmup,
+		zThreshold: cfg.AnomalyZThreshold,
 	}
+}
 
-	var entries []LogEntry
-	for _, line := range strings.Split(string(content), "\n") {
-		if line == "" {
-			continue
-		}
-		var entry LogEntry
-		if err := json.Unmarshal([]byte(line), &entry); err != nil {
-			continue
+// Reset forgets every line recorded so far.
+func (s *StatsCollector) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buckets = make([]statsBucket, len(s.buckets))
+	s.errorRuns = make(map[string]*ErrorSequence)
+	s.sequences = nil
+	s.baselines = make(map[string]*ewmaBaseline)
+	s.anomalies = nil
+}
+
+// Record adds one emitted line. service may be empty for formats without one,
+// and duration is 0 when the format carries no duration.
+func (s *StatsCollector) Record(ts time.Time, level, service string, duration int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.bucketFor(ts)
+	b.total++
+	b.logTypeCounts[level]++
+	if service != "" {
+		b.serviceCalls[service]++
+		if duration > 0 {
+			b.serviceDurationSum[service] += float64(duration)
+			b.serviceDurationCount[service]++
+
+			sketch, ok := b.serviceLatency[service]
+			if !ok {
+				sketch = newQuantileSketch()
+				b.serviceLatency[service] = sketch
+			}
+			sketch.Add(float64(duration))
 		}
-		entries = append(entries, entry)
 	}
 
-	analyzeEntries(&stats, entries)
-	return stats
+	s.trackErrorBurst(ts, level, service)
+	if service != "" && duration > 0 {
+		s.trackDurationAnomaly(ts, service, duration)
+	}
 }
 
-func analyzeEntries(stats *Statistics, entries []LogEntry) {
-	for _, entry := range entries {
-		stats.LogTypeCounts[entry.LogType]++
+func (s *StatsCollector) bucketFor(ts time.Time) *statsBucket {
+	start := ts.Truncate(s.bucketWidth)
+	// buckets before 1970 have negative numbers, which % keeps negative
+	idx := int((start.UnixNano() / int64(s.bucketWidth)) % int64(len(s.buckets)))
+	if idx < 0 {
+		idx += len(s.buckets)
+	}
+
+	b := &s.buckets[idx]
+	if !b.start.Equal(start) {
+		*b = statsBucket{
+			start:                start,
+			logTypeCounts:        make(map[string]int),
+			serviceCalls:         make(map[string]int),
+			serviceDurationSum:   make(map[string]float64),
+			serviceDurationCount: make(map[string]int),
+			serviceLatency:       make(map[string]*quantileSketch),
+		}
+	}
+	return b
+}
 
-		stats.ServiceDurations[entry.Service] += float64(entry.Duration)
-		stats.ServiceCallCounts[entry.Service]++
+// Snapshot returns the statistics for the lines emitted during the last window.
+func (s *StatsCollector) Snapshot(window time.Duration) Statistics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	now := s.clock.Now()
+	if window <= 0 || window > s.retention {
+		window = s.retention
 	}
+	since := now.Add(-window)
 
-	for service := range stats.ServiceDurations {
-		if count := stats.ServiceCallCounts[service]; count > 0 {
-			stats.ServiceDurations[service] /= float64(count)
-		}
+	stats := Statistics{
+		Window:            window.String(),
+		LogTypeCounts:     make(map[string]int),
+		ServiceDurations:  make(map[string]float64),
+		ServiceCallCounts: make(map[string]int),
+
+		ServiceLatencyPercentiles: make(map[string]LatencyPercentiles),
+		ServiceBaselines:          make(map[string]Baseline),
+
+		ErrorSequences:    ErrorSequences{},
+		AnomalyDetections: Anomalys{},
+		UpdatedAt:         now,
 	}
 
-	stats.ErrorSequences = detectErrorSequences(entries)
-	stats.AnomalyDetections = detectAnomalies(entries)
-}
+	durationCounts := make(map[string]int)
+	latency := make(map[string]*quantileSketch)
+	for _, b := range s.buckets {
+		if b.logTypeCounts == nil || b.start.Add(s.bucketWidth).Before(since) || b.start.After(now) {
+			continue
+		}
 
-func detectErrorSequences(entries []LogEntry) ErrorSequences {
-	sequences := ErrorSequences{}
-	currentSequence := ErrorSequence{}
-	errorCount := 0
-
-	for i, entry := range entries {
-		if entry.LogType == "ERROR" {
-			errorCount++
-			if errorCount == 1 {
-				currentSequence.StartTime, _ = time.Parse(time.RFC3339, entry.Timestamp)
-				currentSequence.Service = entry.Service
-			}
-		} else {
-			if errorCount >= 3 {
-				currentSequence.EndTime, _ = time.Parse(time.RFC3339, entries[i-1].Timestamp)
-				currentSequence.Count = errorCount
-				sequences = append(sequences, currentSequence)
+		stats.TotalCount += b.total
+		for level, count := range b.logTypeCounts {
+			stats.LogTypeCounts[level] += count
+		}
+		for service, count := range b.serviceCalls {
+			stats.ServiceCallCounts[service] += count
+		}
+		for service, sum := range b.serviceDurationSum {
+			stats.ServiceDurations[service] += sum
+			durationCounts[service] += b.serviceDurationCount[service]
+		}
+		for service, sketch := range b.serviceLatency {
+			if _, ok := latency[service]; !ok {
+				latency[service] = newQuantileSketch()
 			}
-			errorCount = 0
+			latency[service].Merge(sketch)
 		}
 	}
 
-	return sequences
-}
+	for service, sketch := range latency {
+		stats.ServiceLatencyPercentiles[service] = sketch.Percentiles()
+	}
+	for service, baseline := range s.baselines {
+		stats.ServiceBaselines[service] = baseline.snapshot()
+	}
 
-func detectAnomalies(entries []LogEntry) []Anomaly {
-	anomalies := []Anomaly{}
-
-	// Calculate baseline metrics
-	baselineDuration := calculateBaselineDuration(entries)
-
-	// Detect duration anomalies
-	for _, entry := range entries {
-		if float64(entry.Duration) > baselineDuration*2 {
-			timestamp, _ := time.Parse(time.RFC3339, entry.Timestamp)
-			anomalies = append(anomalies, Anomaly{
-				Timestamp:  timestamp,
-				Service:    entry.Service,
-				MetricName: "duration",
-				Value:      float64(entry.Duration),
-				Threshold:  baselineDuration * 2,
-			})
+	for service := range stats.ServiceDurations {
+		if count := durationCounts[service]; count > 0 {
+			stats.ServiceDurations[service] /= float64(count)
 		}
 	}
 
-	return anomalies
-}
+	for _, seq := range s.sequences {
+		if !seq.EndTime.Before(since) {
+			stats.ErrorSequences = append(stats.ErrorSequences, seq)
+		}
+	}
 
-func calculateBaselineDuration(entries []LogEntry) float64 {
-	if len(entries) == 0 {
-		return 0
+	// include runs that are still going and already long enough to count
+	openRuns := make([]string, 0, len(s.errorRuns))
+	for service := range s.errorRuns {
+		openRuns = append(openRuns, service)
+	}
+	sort.Strings(openRuns)
+	for _, service := range openRuns {
+		run := s.errorRuns[service]
+		if run.Count >= s.burstMin && !run.EndTime.Before(since) {
+			stats.ErrorSequences = append(stats.ErrorSequences, *run)
+		}
 	}
 
-	var total float64
-	for _, entry := range entries {
-		total += float64(entry.Duration)
+	for _, anomaly := range s.anomalies {
+		if !anomaly.Timestamp.Before(since) {
+			stats.AnomalyDetections = append(stats.AnomalyDetections, anomaly)
+		}
 	}
 
-	return total / float64(len(entries))
+	return stats
+}
+
+func appendBounded[T any](items []T, item T) []T {
+	items = append(items, item)
+	if len(items) > maxStatsEvents {
+		items = items[len(items)-maxStatsEvents:]
+	}
+	return items
 }
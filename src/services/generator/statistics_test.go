@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsBucketsAcrossEpoch(t *testing.T) {
+	tests := []struct {
+		name  string
+		start time.Time
+	}{
+		{"before 1970", time.Date(1969, 12, 31, 23, 58, 0, 0, time.UTC)},
+		{"across 1970", time.Date(1969, 12, 31, 23, 59, 55, 0, time.UTC)},
+		{"after 1970", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock(tt.start)
+			s := NewStatsCollector(clock, Config{StatsBucketSeconds: 10, StatsRetention: 60})
+
+			// one line a second for 50 seconds, well within the retention
+			for i := 0; i < 50; i++ {
+				s.Record(clock.Now(), "INFO", "user-service", 10)
+				clock.Sleep(time.Second)
+			}
+
+			stats := s.Snapshot(0)
+			if stats.TotalCount != 50 || stats.ServiceCallCounts["user-service"] != 50 {
+				t.Errorf("counted %d lines, %d calls, want 50", stats.TotalCount, stats.ServiceCallCounts["user-service"])
+			}
+		})
+	}
+}
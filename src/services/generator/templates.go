@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MessageTemplates are user-defined messages written with text/template. A
+// service's templates for a level win over the templates for the level alone.
+type MessageTemplates struct {
+	Levels   map[string][]*template.Template
+	Services map[string]map[string][]*template.Template
+}
+
+// messageTemplateFile is the YAML layout of MESSAGE_TEMPLATES_FILE.
+type messageTemplateFile struct {
+	Levels   map[string][]string            `yaml:"levels"`
+	Services map[string]map[string][]string `yaml:"services"`
+}
+
+// TemplateData is what a message template can refer to, e.g. {{.UserID}}.
+type TemplateData struct {
+	UserID    string
+	SessionID string
+	Service   string
+	Level     string
+	State     string
+}
+
+// templateFuncs are the functions templates can call. They draw from the
+// generator's random source so seeded runs stay reproducible.
+func (lg *LogGenerator) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// randInt returns a number between min and max, both included
+		"randInt": func(min, max int) int {
+			if max < min {
+				min, max = max, min
+			}
+			return min + lg.rng.Intn(max-min+1)
+		},
+		"pick": func(values ...string) string {
+			if len(values) == 0 {
+				return ""
+			}
+			return values[lg.rng.Intn(len(values))]
+		},
+		"uuid": lg.uuid,
+	}
+}
+
+// LoadMessageTemplates parses the templates in path and executes each once, so
+// unknown fields and functions are reported at load time rather than per line.
+func (lg *LogGenerator) LoadMessageTemplates(path string) (*MessageTemplates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message templates: %w", err)
+	}
+
+	var file messageTemplateFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse message templates: %w", err)
+	}
+
+	templates := &MessageTemplates{Services: make(map[string]map[string][]*template.Template)}
+	if templates.Levels, err = lg.parseLevelTemplates("levels", file.Levels); err != nil {
+		return nil, err
+	}
+	services := make([]string, 0, len(file.Services))
+	for service := range file.Services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		parsed, err := lg.parseLevelTemplates("services."+service, file.Services[service])
+		if err != nil {
+			return nil, err
+		}
+		templates.Services[service] = parsed
+	}
+
+	return templates, nil
+}
+
+func (lg *LogGenerator) parseLevelTemplates(prefix string, levels map[string][]string) (map[string][]*template.Template, error) {
+	parsed := make(map[string][]*template.Template)
+
+	names := make([]string, 0, len(levels))
+	for level := range levels {
+		names = append(names, level)
+	}
+	sort.Strings(names)
+
+	for _, level := range names {
+		if !isLogLevel(level) {
+			return nil, fmt.Errorf("%s: unknown log level %q", prefix, level)
+		}
+		for i, text := range levels[level] {
+			name := fmt.Sprintf("%s.%s[%d]", prefix, level, i)
+			tmpl, err := template.New(name).Funcs(lg.templateFuncs()).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("message template %s: %w", name, err)
+			}
+			if err := checkTemplate(tmpl); err != nil {
+				return nil, fmt.Errorf("message template %s: %w", name, err)
+			}
+			parsed[level] = append(parsed[level], tmpl)
+		}
+	}
+	return parsed, nil
+}
+
+// checkTemplate executes a copy of tmpl with its own random source, so loading
+// templates does not move a seeded generator's sequence.
+func checkTemplate(tmpl *template.Template) error {
+	probe, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	scratch := &LogGenerator{rng: rand.New(rand.NewSource(1))}
+	return probe.Funcs(scratch.templateFuncs()).Execute(io.Discard, TemplateData{})
+}
+
+// ReloadMessageTemplates reads MESSAGE_TEMPLATES_FILE again. The templates in
+// use are kept when the file no longer loads.
+func (lg *LogGenerator) ReloadMessageTemplates() error {
+	path := lg.Config().MessageTemplatesFile
+	if path == "" {
+		return fmt.Errorf("MESSAGE_TEMPLATES_FILE is not set")
+	}
+
+	templates, err := lg.LoadMessageTemplates(path)
+	if err != nil {
+		return err
+	}
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	lg.templates = templates
+	return nil
+}
+
+// templateMessage renders a template for level and service, and reports
+// false when none is defined.
+func (lg *LogGenerator) templateMessage(level, service string, session UserSession) (string, bool) {
+	if lg.templates == nil {
+		return "", false
+	}
+
+	candidates := lg.templates.Services[service][level]
+	if len(candidates) == 0 {
+		candidates = lg.templates.Levels[level]
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	tmpl := candidates[lg.rng.Intn(len(candidates))]
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, TemplateData{
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+		Service:   service,
+		Level:     level,
+		State:     session.State,
+	})
+	if err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// uuid returns a random (version 4) UUID.
+func (lg *LogGenerator) uuid() string {
+	b := make([]byte, 16)
+	for i := range b {
+		b[i] = byte(lg.rng.Intn(256))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
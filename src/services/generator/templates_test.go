@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLoadMessageTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			yaml: "levels:\n  ERROR: ['{{.UserID}} failed']\nservices:\n  payment-service:\n    INFO: ['{{pick \"a\" \"b\"}} {{randInt 1 5}} {{uuid}}']\n",
+		},
+		{
+			name:    "unknown level",
+			yaml:    "levels:\n  error: ['failed']\n",
+			wantErr: `levels: unknown log level "error"`,
+		},
+		{
+			name:    "unknown service level",
+			yaml:    "services:\n  payment-service:\n    FATAL: ['failed']\n",
+			wantErr: `services.payment-service: unknown log level "FATAL"`,
+		},
+		{
+			name:    "syntax error",
+			yaml:    "levels:\n  ERROR: ['{{.UserID']\n",
+			wantErr: "message template levels.ERROR[0]",
+		},
+		{
+			name:    "unknown function",
+			yaml:    "levels:\n  ERROR: ['{{shout .UserID}}']\n",
+			wantErr: `function "shout" not defined`,
+		},
+		{
+			name:    "unknown field",
+			yaml:    "levels:\n  INFO: ['ok', '{{.Email}}']\n",
+			wantErr: "message template levels.INFO[1]",
+		},
+		{
+			name:    "not yaml",
+			yaml:    "levels: [",
+			wantErr: "failed to parse message templates",
+		},
+	}
+
+	lg := newTestGenerator(t, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeTempFile(t, tt.yaml)
+			_, err := lg.LoadMessageTemplates(file.Name())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadMessageTemplates() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTemplateMessage(t *testing.T) {
+	file := writeTempFile(t, `levels:
+  ERROR: ['{{.Level}} for {{.UserID}} in {{.Service}}']
+  INFO: ['{{pick "red" "green"}} {{randInt 5 7}} {{uuid}}']
+services:
+  payment-service:
+    ERROR: ['charge declined for {{.UserID}} at {{.State}}']
+`)
+	lg := newTestGenerator(t, map[string]string{"SEED": "2", "MESSAGE_TEMPLATES_FILE": file.Name()})
+	session := UserSession{UserID: "user_7", SessionID: "sess_1", State: "checkout"}
+
+	tests := []struct {
+		level, service string
+		want           string // a pattern, or "" when the built-in messages apply
+	}{
+		{ERROR, "payment-service", `^charge declined for user_7 at checkout$`},
+		{ERROR, "user-service", `^ERROR for user_7 in user-service$`},
+		{INFO, "payment-service", `^(red|green) [5-7] [0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{WARNING, "payment-service", ""},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got, ok := lg.templateMessage(tt.level, tt.service, session)
+			if ok != (tt.want != "") {
+				t.Fatalf("templateMessage(%s, %s) found a template %v", tt.level, tt.service, ok)
+			}
+			if ok && !regexp.MustCompile(tt.want).MatchString(got) {
+				t.Fatalf("templateMessage(%s, %s) = %q, want %s", tt.level, tt.service, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestReloadMessageTemplates(t *testing.T) {
+	file := writeTempFile(t, "levels:\n  ERROR: ['first version']\n")
+	lg := newTestGenerator(t, map[string]string{"MESSAGE_TEMPLATES_FILE": file.Name()})
+	router := NewApp(lg.Config(), NewGeneratorManager(lg.Config(), lg)).setupRouter()
+
+	steps := []struct {
+		name   string
+		yaml   string
+		status int
+		want   string
+	}{
+		{"new templates", "levels:\n  ERROR: ['second version']\n", http.StatusOK, "second version"},
+		{"broken file keeps the templates in use", "levels:\n  ERROR: ['{{.Nope']\n", http.StatusUnprocessableEntity, "second version"},
+		{"fixed again", "levels:\n  ERROR: ['third version']\n", http.StatusOK, "third version"},
+	}
+	if got, _ := lg.templateMessage(ERROR, "user-service", UserSession{}); got != "first version" {
+		t.Fatalf("loaded at startup: %q", got)
+	}
+	for _, step := range steps {
+		if err := os.WriteFile(file.Name(), []byte(step.yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/templates/reload", nil))
+		if rec.Code != step.status {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, rec.Code, step.status, rec.Body)
+		}
+		if got, _ := lg.templateMessage(ERROR, "user-service", UserSession{}); got != step.want {
+			t.Errorf("%s: message %q, want %q", step.name, got, step.want)
+		}
+	}
+}
+
+func TestReloadWithoutTemplatesFile(t *testing.T) {
+	lg := newTestGenerator(t, map[string]string{"MESSAGE_TEMPLATES_FILE": ""})
+	if err := lg.ReloadMessageTemplates(); err == nil || !strings.Contains(err.Error(), "MESSAGE_TEMPLATES_FILE is not set") {
+		t.Errorf("ReloadMessageTemplates() error = %v", err)
+	}
+}
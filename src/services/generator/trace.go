@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the deepest call chain a simulated request may follow, which also stops
+// cycles in a misconfigured call graph
+const maxTraceDepth = 6
+
+var defaultTraceCallGraph = "user-service->inventory-service,user-service->payment-service,payment-service->notification-service"
+
+// CallGraph maps a service to the downstream services it calls.
+type CallGraph map[string][]string
+
+// ParseCallGraph reads "caller->callee" edges separated by commas.
+func ParseCallGraph(value string) (CallGraph, error) {
+	graph := CallGraph{}
+
+	for _, edge := range strings.Split(value, ",") {
+		edge = strings.TrimSpace(edge)
+		if edge == "" {
+			continue
+		}
+
+		caller, callee, ok := strings.Cut(edge, "->")
+		caller, callee = strings.TrimSpace(caller), strings.TrimSpace(callee)
+		if !ok || caller == "" || callee == "" {
+			return nil, fmt.Errorf("invalid call graph edge %q, expected caller->callee", edge)
+		}
+		if caller == callee {
+			return nil, fmt.Errorf("service %s cannot call itself", caller)
+		}
+
+		graph[caller] = append(graph[caller], callee)
+	}
+
+	return graph, nil
+}
+
+// Roots returns the services that call others but are never called, which is
+// where simulated requests enter.
+func (g CallGraph) Roots() []string {
+	called := make(map[string]bool)
+	for _, callees := range g {
+		for _, callee := range callees {
+			called[callee] = true
+		}
+	}
+
+	var roots []string
+	for caller := range g {
+		if !called[caller] {
+			roots = append(roots, caller)
+		}
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// restrictTo drops edges that reference services the generator is not
+// configured to emit for.
+func (g CallGraph) restrictTo(services []string) CallGraph {
+	restricted := CallGraph{}
+	for caller, callees := range g {
+		if !contains(services, caller) {
+			continue
+		}
+		for _, callee := range callees {
+			if contains(services, callee) {
+				restricted[caller] = append(restricted[caller], callee)
+			}
+		}
+	}
+	return restricted
+}
+
+type span struct {
+	Service      string
+	SpanID       string
+	ParentSpanID string
+	Start        time.Time
+	End          time.Time
+	Level        string
+	Parent       string
+	// Message is set when a failure decided the span's line
+	Message string
+}
+
+// generateTraceLogs simulates one request through the call graph and returns a
+// JSON line per span, each sharing the trace and request ids. Children run
+// sequentially inside their parent so every child duration nests inside its
+// parent's duration.
+func (lg *LogGenerator) generateTraceLogs(route *entryRoute) string {
+	graph := lg.callGraph.restrictTo(lg.cfg.Services)
+	roots := graph.Roots()
+	if len(roots) == 0 {
+		return lg.generateJSONLog(route)
+	}
+
+	root := roots[lg.rng.Intn(len(roots))]
+	now := lg.clock.Now()
+	traceID := lg.randomHex(16)
+	requestID := fmt.Sprintf("req-%d-%d", now.Unix(), lg.rng.Intn(9000)+1000)
+
+	var spans []span
+	lg.buildSpan(graph, root, "", "", now, 0, &spans)
+
+	// the request is the user's next journey step; the entry span logs it
+	session, rootLevel, rootMessage := lg.nextSessionEvent(spans[len(spans)-1].Level, root)
+	rootMessage, _ = lg.piiMessage(rootMessage, false)
+
+	// spans finish children first, so emit them in the order they would be logged
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].End.Before(spans[j].End) })
+
+	lines := make([]string, 0, len(spans))
+	for _, s := range spans {
+		var message string
+		switch {
+		case s.Parent == "":
+			s.Level, message = rootLevel, rootMessage
+		case s.Message != "":
+			message = s.Message
+		case s.Level == WARNING || s.Level == ERROR || s.Level == CRITICAL:
+			message = lg.createMessageFromPattern(s.Level, s.Service, UserSession{})
+		default:
+			message = fmt.Sprintf("Handled call from %s", s.Parent)
+		}
+
+		lg.stats.Record(s.End, s.Level, s.Service, int(s.End.Sub(s.Start)/time.Millisecond))
+
+		host := lg.fleetHost()
+		route.add(host, s.Service)
+		entry := LogEntry{
+			Timestamp:    s.End.Format(time.RFC3339Nano),
+			LogType:      s.Level,
+			Service:      s.Service,
+			Host:         host,
+			RequestID:    requestID,
+			UserID:       session.UserID,
+			SessionID:    session.SessionID,
+			Duration:     int(s.End.Sub(s.Start) / time.Millisecond),
+			Message:      message,
+			TraceID:      traceID,
+			SpanID:       s.SpanID,
+			ParentSpanID: s.ParentSpanID,
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			panic("unable to marshal log entry")
+		}
+		lines = append(lines, string(data))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// buildSpan appends the span for service and its descendants to spans and
+// returns the span's level so a failing child can degrade its parent.
+func (lg *LogGenerator) buildSpan(graph CallGraph, service, parent, parentSpanID string, start time.Time, depth int, spans *[]span) string {
+	s := span{
+		Service:      service,
+		SpanID:       lg.randomHex(8),
+		ParentSpanID: parentSpanID,
+		Start:        start,
+		Level:        lg.selectLogType(service),
+		Parent:       parent,
+	}
+	// the entry span's line is the user's journey step, which checks for
+	// failures itself
+	if parent != "" {
+		if level, message, ok := lg.cascadeLine(service); ok {
+			s.Level, s.Message = level, message
+		}
+	}
+
+	// some local work before the first downstream call
+	cursor := start.Add(time.Duration(lg.rng.Intn(20)+1) * time.Millisecond)
+
+	if depth < maxTraceDepth {
+		for _, callee := range graph[service] {
+			childStart := cursor.Add(time.Duration(lg.rng.Intn(3)) * time.Millisecond)
+			childLevel := lg.buildSpan(graph, callee, service, s.SpanID, childStart, depth+1, spans)
+			cursor = (*spans)[len(*spans)-1].End
+
+			if (childLevel == ERROR || childLevel == CRITICAL) && (s.Level == INFO || s.Level == DEBUG) {
+				s.Level = WARNING
+			}
+		}
+	}
+
+	s.End = cursor.Add(time.Duration(lg.cascadeLatency(service, lg.serviceLatency(service))) * time.Millisecond)
+	*spans = append(*spans, s)
+	return s.Level
+}
+
+func (lg *LogGenerator) randomHex(bytes int) string {
+	buf := make([]byte, bytes)
+	for i := range buf {
+		buf[i] = byte(lg.rng.Intn(256))
+	}
+	return fmt.Sprintf("%x", buf)
+}
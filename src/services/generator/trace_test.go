@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeafFailureDegradesCallersInTraces(t *testing.T) {
+	lg := newTestGenerator(t, map[string]string{
+		"SEED":             "3",
+		"FAKE_CLOCK_START": "2026-09-01T10:00:00Z",
+		"SERVICES":         "user-service,payment-service,notification-service",
+		"TRACE_CALL_GRAPH": "user-service->payment-service,payment-service->notification-service",
+		"CASCADE_LAG":      "5",
+	})
+	if _, err := lg.InjectFailure("notification-service", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// let the failure reach every caller
+	lg.clock.Sleep(time.Minute)
+
+	type seen struct{ lines, failing, cascade int }
+	services := map[string]*seen{}
+	for i := 0; i < 200; i++ {
+		lg.mu.Lock()
+		trace := lg.generateTraceLogs(nil)
+		lg.mu.Unlock()
+
+		levels := map[string]string{}
+		for _, line := range strings.Split(trace, "\n") {
+			var entry LogEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatal(err)
+			}
+			levels[entry.Service] = entry.LogType
+
+			s := services[entry.Service]
+			if s == nil {
+				s = &seen{}
+				services[entry.Service] = s
+			}
+			s.lines++
+			if contains(failureMessages, entry.Message) {
+				s.failing++
+			}
+			// callers name the dependency and how long the call took
+			if strings.HasSuffix(entry.Message, "ms") && (strings.Contains(entry.Message, "notification-service") || strings.Contains(entry.Message, "payment-service")) {
+				s.cascade++
+			}
+		}
+
+		if child := levels["notification-service"]; child == ERROR || child == CRITICAL {
+			if parent := levels["payment-service"]; parent == INFO || parent == DEBUG {
+				t.Fatalf("payment-service logged %s over a failing notification-service", parent)
+			}
+		}
+	}
+
+	tests := []struct {
+		service     string
+		minFailing  int
+		minCascade  int
+		maxCascade  int
+		description string
+	}{
+		{"notification-service", 150, 0, 0, "reports the failure itself"},
+		{"payment-service", 0, 80, 140, "reports its dependency failing"},
+		{"user-service", 0, 35, 100, "reports the failure further upstream, less often"},
+	}
+	for _, tt := range tests {
+		s := services[tt.service]
+		if s == nil || s.lines != 200 {
+			t.Fatalf("%s: got %+v, want a span in every trace", tt.service, s)
+		}
+		if s.failing < tt.minFailing || s.cascade < tt.minCascade || s.cascade > tt.maxCascade {
+			t.Errorf("%s %s: %d failure and %d cascade messages in %d spans", tt.service, tt.description, s.failing, s.cascade, s.lines)
+		}
+	}
+}
+
+func TestTraceSpansNest(t *testing.T) {
+	lg := newTestGenerator(t, map[string]string{
+		"SEED":             "8",
+		"FAKE_CLOCK_START": "2026-09-01T10:00:00Z",
+		"TRACE_CALL_GRAPH": "api-gateway->user-service,api-gateway->payment-service,payment-service->notification-service,payment-service->inventory-service",
+		"SERVICES":         "api-gateway,user-service,payment-service,inventory-service,notification-service",
+	})
+
+	type timedSpan struct {
+		entry      LogEntry
+		start, end time.Time
+	}
+	for i := 0; i < 50; i++ {
+		lg.mu.Lock()
+		trace := lg.generateTraceLogs(nil)
+		lg.mu.Unlock()
+
+		spans := map[string]timedSpan{}
+		children := map[string][]timedSpan{}
+		var root string
+		var last time.Time
+		for _, line := range strings.Split(trace, "\n") {
+			var entry LogEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatal(err)
+			}
+			end, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if end.Before(last) {
+				t.Fatalf("span of %s logged at %s after one at %s", entry.Service, end, last)
+			}
+			last = end
+
+			s := timedSpan{entry: entry, start: end.Add(-time.Duration(entry.Duration) * time.Millisecond), end: end}
+			spans[entry.SpanID] = s
+			if entry.ParentSpanID == "" {
+				if root != "" {
+					t.Fatalf("trace has two root spans:\n%s", trace)
+				}
+				root = entry.SpanID
+			} else {
+				children[entry.ParentSpanID] = append(children[entry.ParentSpanID], s)
+			}
+		}
+
+		if len(spans) != 5 || root == "" || spans[root].entry.Service != "api-gateway" {
+			t.Fatalf("want 5 spans under api-gateway, got:\n%s", trace)
+		}
+		for parentID, kids := range children {
+			parent, ok := spans[parentID]
+			if !ok {
+				t.Fatalf("span with unknown parent %s:\n%s", parentID, trace)
+			}
+			for j, child := range kids {
+				if child.entry.TraceID != parent.entry.TraceID || child.entry.RequestID != parent.entry.RequestID {
+					t.Errorf("%s does not share its parent's trace and request ids", child.entry.Service)
+				}
+				// durations are whole milliseconds, so starts are off by up to one
+				if child.start.Before(parent.start.Add(-time.Millisecond)) || child.end.After(parent.end) {
+					t.Errorf("%s (%s to %s) is not inside %s (%s to %s)",
+						child.entry.Service, child.start, child.end, parent.entry.Service, parent.start, parent.end)
+				}
+				// calls from one service follow each other
+				if j > 0 && child.start.Before(kids[j-1].end.Add(-time.Millisecond)) {
+					t.Errorf("%s starts before its sibling %s ends", child.entry.Service, kids[j-1].entry.Service)
+				}
+			}
+		}
+	}
+}
+
+func TestParseCallGraph(t *testing.T) {
+	tests := []struct {
+		value   string
+		roots   string
+		wantErr bool
+	}{
+		{value: "a->b,b->c", roots: "a"},
+		{value: " a -> b , c->b ,", roots: "a c"},
+		{value: "", roots: ""},
+		{value: "a-b", wantErr: true},
+		{value: "a->", wantErr: true},
+		{value: "a->a", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			graph, err := ParseCallGraph(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCallGraph(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if err == nil && strings.Join(graph.Roots(), " ") != tt.roots {
+				t.Errorf("roots = %v, want %s", graph.Roots(), tt.roots)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// how often the traffic noise is drawn again; between draws it holds, so the
+// rate wanders instead of flickering line by line
+const trafficNoiseInterval = time.Second
+
+// TrafficCurve shapes LOG_RATE over the day and week: a sinusoid peaking at
+// PeakHour that swings Amplitude either side of the mean, scaled by
+// WeekendFactor on Saturdays and Sundays.
+type TrafficCurve struct {
+	PeakHour      float64
+	Amplitude     float64
+	WeekendFactor float64
+	Location      *time.Location
+}
+
+// the daily shape used when nothing is configured
+var defaultTrafficCurve = TrafficCurve{PeakHour: 14, Amplitude: 0.6, WeekendFactor: 1, Location: time.UTC}
+
+// TrafficCurve returns the curve configured by the TRAFFIC_* settings.
+func (c Config) TrafficCurve() (TrafficCurve, error) {
+	loc, err := time.LoadLocation(c.TrafficTimezone)
+	if err != nil {
+		return TrafficCurve{}, fmt.Errorf("TRAFFIC_TIMEZONE: %w", err)
+	}
+	return TrafficCurve{
+		PeakHour:      c.TrafficPeakHour,
+		Amplitude:     c.TrafficAmplitude,
+		WeekendFactor: c.TrafficWeekendFactor,
+		Location:      loc,
+	}, nil
+}
+
+// Factor is the share of LOG_RATE due at t. It averages 1 over a weekday.
+func (tc TrafficCurve) Factor(t time.Time) float64 {
+	t = t.In(tc.Location)
+	hour := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+	factor := 1 + tc.Amplitude*math.Cos(2*math.Pi*(hour-tc.PeakHour)/24)
+
+	if day := t.Weekday(); day == time.Saturday || day == time.Sunday {
+		factor *= tc.WeekendFactor
+	}
+	return factor
+}
+
+// trafficFactor is the curve's factor for now with TRAFFIC_NOISE applied. The
+// caller holds lg.mu.
+func (lg *LogGenerator) trafficFactor(now time.Time) float64 {
+	factor := lg.traffic.Factor(now)
+
+	if lg.cfg.TrafficNoise > 0 {
+		if now.Sub(lg.trafficNoiseAt) >= trafficNoiseInterval || now.Before(lg.trafficNoiseAt) {
+			lg.trafficNoise = 1 + lg.cfg.TrafficNoise*lg.rng.NormFloat64()
+			lg.trafficNoiseAt = now
+		}
+		factor *= math.Max(lg.trafficNoise, 0)
+	}
+	return factor
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTrafficCurveFactor(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	daily := TrafficCurve{PeakHour: 14, Amplitude: 0.6, WeekendFactor: 0.5, Location: time.UTC}
+	local := daily
+	local.Location = newYork
+
+	// 2026-09-01 is a Tuesday, 2026-09-05 a Saturday
+	tests := []struct {
+		name  string
+		curve TrafficCurve
+		at    string
+		want  float64
+	}{
+		{"peak", daily, "2026-09-01T14:00:00Z", 1.6},
+		{"trough", daily, "2026-09-01T02:00:00Z", 0.4},
+		{"morning mean", daily, "2026-09-01T08:00:00Z", 1},
+		{"evening mean", daily, "2026-09-01T20:00:00Z", 1},
+		{"between the hours", daily, "2026-09-01T11:00:00Z", 1 + 0.6*math.Cos(math.Pi/4)},
+		{"weekend peak", daily, "2026-09-05T14:00:00Z", 0.8},
+		{"weekend trough", daily, "2026-09-06T02:00:00Z", 0.2},
+		{"flat", TrafficCurve{PeakHour: 9, WeekendFactor: 1, Location: time.UTC}, "2026-09-05T03:00:00Z", 1},
+		{"peak in local time", local, "2026-09-01T18:00:00Z", 1.6},
+		// Friday evening in New York, though Saturday in UTC
+		{"weekday in local time", local, "2026-09-05T02:00:00Z", 1 + 0.6*math.Cos(2*math.Pi*8/24)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.curve.Factor(at); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Factor(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrafficCurveAveragesOneOverWeekday(t *testing.T) {
+	curve := TrafficCurve{PeakHour: 17.5, Amplitude: 0.9, WeekendFactor: 0.3, Location: time.UTC}
+	day := time.Date(2026, 9, 2, 0, 0, 0, 0, time.UTC)
+
+	var total float64
+	const samples = 24 * 60
+	for i := 0; i < samples; i++ {
+		total += curve.Factor(day.Add(time.Duration(i) * time.Minute))
+	}
+	if mean := total / samples; math.Abs(mean-1) > 1e-6 {
+		t.Errorf("mean factor over a weekday = %v, want 1", mean)
+	}
+}
+
+func TestTrafficNoise(t *testing.T) {
+	lg := newTestGenerator(t, map[string]string{
+		"SEED":                   "8",
+		"TRAFFIC_CURVE":          "true",
+		"TRAFFIC_AMPLITUDE":      "0",
+		"TRAFFIC_WEEKEND_FACTOR": "1",
+		"TRAFFIC_NOISE":          "0.2",
+	})
+	start := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	first := lg.trafficFactor(start)
+	if held := lg.trafficFactor(start.Add(trafficNoiseInterval / 2)); held != first {
+		t.Errorf("noise moved from %v to %v within %v", first, held, trafficNoiseInterval)
+	}
+
+	var sum, sumSquares float64
+	const draws = 5000
+	for i := 1; i <= draws; i++ {
+		f := lg.trafficFactor(start.Add(time.Duration(i) * trafficNoiseInterval))
+		if f < 0 {
+			t.Fatalf("factor %v is negative", f)
+		}
+		sum += f
+		sumSquares += f * f
+	}
+	mean := sum / draws
+	stddev := math.Sqrt(sumSquares/draws - mean*mean)
+	if math.Abs(mean-1) > 0.02 || math.Abs(stddev-0.2) > 0.02 {
+		t.Errorf("noise has mean %.3f and deviation %.3f, want 1 and 0.2", mean, stddev)
+	}
+}
+
+func TestTickFollowsTrafficCurve(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		at   string
+		want float64
+	}{
+		{"curve off", map[string]string{"TRAFFIC_CURVE": "false"}, "2026-09-01T14:00:00Z", 100},
+		{"weekday peak", nil, "2026-09-01T14:00:00Z", 150},
+		{"weekday trough", nil, "2026-09-01T02:00:00Z", 50},
+		{"weekend peak", nil, "2026-09-05T14:00:00Z", 75},
+		// the curve never takes the rate below one line a second
+		{"silent night", map[string]string{"TRAFFIC_AMPLITUDE": "1"}, "2026-09-01T02:00:00Z", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{
+				"FAKE_CLOCK_START":       tt.at,
+				"LOG_RATE":               "100",
+				"ENABLE_BURSTS":          "false",
+				"TRAFFIC_CURVE":          "true",
+				"TRAFFIC_AMPLITUDE":      "0.5",
+				"TRAFFIC_WEEKEND_FACTOR": "0.5",
+				"TRAFFIC_NOISE":          "0",
+			}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			lg := newTestGenerator(t, env)
+
+			rate, ok := lg.tick(lg.clock.Now())
+			if !ok || math.Abs(rate-tt.want) > 1e-9 {
+				t.Errorf("tick() = %v, %v, want %v", rate, ok, tt.want)
+			}
+		})
+	}
+}